@@ -0,0 +1,184 @@
+package arg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+)
+
+// applyConfigFile loads the JSON config file named by the option tagged with
+// "config", if there is one, and uses it to set options that were not given on
+// the command line or in the environment. The keys of the file are the long
+// names of the options, and the options of a subcommand are given in a nested
+// object under the name of the subcommand.
+func (p *Parser) applyConfigFile() error {
+	var cfg *spec
+	for _, spec := range p.specs {
+		if spec.configFile {
+			cfg = spec
+			break
+		}
+	}
+	if cfg == nil {
+		return nil
+	}
+
+	name := p.val(cfg.dest).String()
+	if name == "" {
+		return nil
+	}
+
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		// a config file that was not asked for explicitly is allowed to be missing
+		if os.IsNotExist(err) && !p.wasPresent[cfg] {
+			return nil
+		}
+		return fmt.Errorf("error reading config file %s: %v", name, err)
+	}
+
+	var values map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("error parsing config file %s: %v", name, err)
+	}
+
+	return p.applyConfigValues(name, p.cmd, values, "", true)
+}
+
+// applyConfigValues sets the options of the given command from the values in
+// a config file. Values for subcommands that were not selected are checked but
+// not applied.
+func (p *Parser) applyConfigValues(file string, cmd *command, values map[string]interface{}, prefix string, apply bool) error {
+	// go through the keys in order so that errors are reported consistently
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		raw := values[key]
+
+		if subcmd := findSubcommand(cmd.subcommands, key); subcmd != nil {
+			obj, ok := raw.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("error processing config file %s: key %q: expected an object for subcommand %s",
+					file, prefix+key, subcmd.name)
+			}
+			active := apply
+			if active {
+				v := p.val(subcmd.dest)
+				active = v.IsValid() && !v.IsNil()
+			}
+			if err := p.applyConfigValues(file, subcmd, obj, prefix+key+".", active); err != nil {
+				return err
+			}
+			continue
+		}
+
+		spec := findConfigOption(cmd.specs, key)
+		if spec == nil {
+			return fmt.Errorf("error processing config file %s: unknown key %q", file, prefix+key)
+		}
+
+		strs, err := configStrings(raw, spec)
+		if err != nil {
+			return fmt.Errorf("error processing config file %s: key %q: %v", file, prefix+key, err)
+		}
+
+		// values from the command line and environment take precedence, also
+		// over values for other options in the same group
+		if !apply || raw == nil || spec.configFile || p.wasPresent[spec] || p.givenInGroup(spec) {
+			continue
+		}
+
+		if spec.multiple {
+			err = setValues(p.val(spec.dest), spec, strs, true)
+		} else {
+			err = setValue(p.val(spec.dest), spec, strs[0])
+		}
+		if err != nil {
+			return fmt.Errorf("error processing config file %s: key %q: %v", file, prefix+key, err)
+		}
+		p.wasPresent[spec] = true
+		p.record(spec, OriginConfigFile, "config file "+file, strs, true)
+	}
+	return nil
+}
+
+// findConfigOption finds an option from the key used for it in a config file
+func findConfigOption(specs []*spec, key string) *spec {
+	for _, spec := range specs {
+		if spec.long == key {
+			return spec
+		}
+	}
+	return nil
+}
+
+// configStrings converts a value decoded from a config file into the strings
+// that would be given for the option on the command line
+func configStrings(raw interface{}, spec *spec) ([]string, error) {
+	switch raw := raw.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		if !spec.multiple {
+			return nil, fmt.Errorf("expected a single value but got a list")
+		}
+		var out []string
+		for _, elem := range raw {
+			s, err := configScalar(elem)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	case map[string]interface{}:
+		if spec.typ.Kind() != reflect.Map {
+			return nil, fmt.Errorf("expected a single value but got an object")
+		}
+		// present the entries as key=value pairs, as on the command line
+		keys := make([]string, 0, len(raw))
+		for key := range raw {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var out []string
+		for _, key := range keys {
+			s, err := configScalar(raw[key])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, key+"="+s)
+		}
+		return out, nil
+	default:
+		s, err := configScalar(raw)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+}
+
+// configScalar converts a single value decoded from a config file to a string
+func configScalar(raw interface{}) (string, error) {
+	switch raw := raw.(type) {
+	case string:
+		return raw, nil
+	case json.Number:
+		return raw.String(), nil
+	case bool:
+		return fmt.Sprintf("%t", raw), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", raw)
+	}
+}
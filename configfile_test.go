@@ -0,0 +1,190 @@
+package arg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFile(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"app.json": `{
+			"name": "from-file",
+			"workers": 4,
+			"debug": true,
+			"tags": ["a", "b"],
+			"labels": {"env": "prod"},
+			"timeout": null
+		}`,
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Config  string `arg:"config"`
+		Name    string
+		Workers int
+		Debug   bool
+		Tags    []string
+		Labels  map[string]string
+		Timeout string
+	}
+	args.Timeout = "10s"
+	err := parse("--config "+filepath.Join(dir, "app.json"), &args)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", args.Name)
+	assert.Equal(t, 4, args.Workers)
+	assert.True(t, args.Debug)
+	assert.Equal(t, []string{"a", "b"}, args.Tags)
+	assert.Equal(t, map[string]string{"env": "prod"}, args.Labels)
+	assert.Equal(t, "10s", args.Timeout)
+}
+
+func TestConfigFilePrecedence(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"app.json": `{"a": "file", "b": "file", "c": "file"}`,
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Config string `arg:"config"`
+		A      string `arg:"env:CONFIG_TEST_A"`
+		B      string `arg:"env:CONFIG_TEST_B"`
+		C      string
+		D      string
+	}
+	args.C = "default"
+	args.D = "default"
+	setenv(t, "CONFIG_TEST_A", "env")
+	setenv(t, "CONFIG_TEST_B", "env")
+	defer os.Unsetenv("CONFIG_TEST_A")
+	defer os.Unsetenv("CONFIG_TEST_B")
+
+	err := parse("--b cli --config "+filepath.Join(dir, "app.json"), &args)
+	require.NoError(t, err)
+	assert.Equal(t, "env", args.A)
+	assert.Equal(t, "cli", args.B)
+	assert.Equal(t, "file", args.C)
+	assert.Equal(t, "default", args.D)
+}
+
+func TestConfigFileDefaultPath(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"app.json": `{"name": "from-file"}`,
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Config string `arg:"config"`
+		Name   string
+	}
+	args.Config = filepath.Join(dir, "app.json")
+	err := parse("", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", args.Name)
+
+	// a missing default config file is not an error
+	args.Config = filepath.Join(dir, "missing.json")
+	args.Name = ""
+	err = parse("", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "", args.Name)
+}
+
+func TestConfigFileMissing(t *testing.T) {
+	var args struct {
+		Config string `arg:"config"`
+	}
+	err := parse("--config does-not-exist.json", &args)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error reading config file does-not-exist.json")
+}
+
+func TestConfigFileRequired(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"app.json": `{"name": "from-file"}`,
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Config string `arg:"config"`
+		Name   string `arg:"required"`
+	}
+	err := parse("--config "+filepath.Join(dir, "app.json"), &args)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", args.Name)
+}
+
+func TestConfigFileSubcommand(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"app.json": `{"verbose": true, "get": {"limit": 5}, "list": {"format": "json"}}`,
+	})
+	defer os.RemoveAll(dir)
+
+	type getCmd struct {
+		Limit int
+	}
+	type listCmd struct {
+		Format string
+	}
+	var args struct {
+		Config  string `arg:"config"`
+		Verbose bool
+		Get     *getCmd  `arg:"subcommand"`
+		List    *listCmd `arg:"subcommand"`
+	}
+	err := parse("--config "+filepath.Join(dir, "app.json")+" get", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Verbose)
+	require.NotNil(t, args.Get)
+	assert.Equal(t, 5, args.Get.Limit)
+	assert.Nil(t, args.List)
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"unknown.json": `{"name": "x", "nmae": "y"}`,
+		"badtype.json": `{"workers": "many"}`,
+		"badsub.json":  `{"get": {"limti": 5}}`,
+		"list.json":    `{"name": ["a", "b"]}`,
+		"syntax.json":  `{"name": `,
+	})
+	defer os.RemoveAll(dir)
+
+	type getCmd struct {
+		Limit int
+	}
+	type cmd struct {
+		Config  string `arg:"config"`
+		Name    string
+		Workers int
+		Get     *getCmd `arg:"subcommand"`
+	}
+
+	for file, msg := range map[string]string{
+		"unknown.json": `unknown key "nmae"`,
+		"badtype.json": `key "workers": strconv.ParseInt: parsing "many": invalid syntax`,
+		"badsub.json":  `unknown key "get.limti"`,
+		"list.json":    `key "name": expected a single value but got a list`,
+	} {
+		var args cmd
+		name := filepath.Join(dir, file)
+		err := parse("--config "+name, &args)
+		assert.EqualError(t, err, "error processing config file "+name+": "+msg)
+	}
+
+	var args cmd
+	err := parse("--config "+filepath.Join(dir, "syntax.json"), &args)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error parsing config file")
+}
+
+func TestConfigFieldNotString(t *testing.T) {
+	var args struct {
+		Config int `arg:"config"`
+	}
+	err := parse("", &args)
+	assert.Error(t, err)
+}
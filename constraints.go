@@ -0,0 +1,206 @@
+package arg
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	scalar "github.com/alexflint/go-scalar"
+)
+
+// Enumerated is the interface that the type of a field can implement to limit
+// its values to a fixed set, in the same way as the choices tag
+type Enumerated interface {
+	// Choices returns the values that are allowed
+	Choices() []string
+}
+
+var enumeratedType = reflect.TypeOf((*Enumerated)(nil)).Elem()
+
+// setValue checks a value against the constraints of an option and then
+// parses it into dest
+func setValue(dest reflect.Value, spec *spec, value string) error {
+	if err := checkValue(spec, value); err != nil {
+		return err
+	}
+	if spec.isPath {
+		value = resolvePath(value, spec.baseDir)
+	}
+	if err := scalar.ParseValue(dest, value); err != nil {
+		if spec.secret {
+			// the error from parsing the value may include it
+			return fmt.Errorf("invalid value %q for %s", secretMask, dest.Type())
+		}
+		return err
+	}
+	if spec.files != nil {
+		return openFiles(dest, spec.files)
+	}
+	return nil
+}
+
+// setValues checks each of the values against the constraints of an option
+// and then parses them into dest as setSlice does
+func setValues(dest reflect.Value, spec *spec, values []string, trunc bool) error {
+	for _, value := range values {
+		if err := checkValue(spec, value); err != nil {
+			return err
+		}
+	}
+	if spec.isPath {
+		resolved := make([]string, len(values))
+		for i, value := range values {
+			resolved[i] = resolvePath(value, spec.baseDir)
+		}
+		values = resolved
+	}
+	if err := setSlice(dest, values, trunc); err != nil {
+		return err
+	}
+	if spec.files != nil {
+		return openFiles(dest, spec.files)
+	}
+	return nil
+}
+
+// checkValue checks a single value, or an element of a slice, against the
+// constraints of an option
+func checkValue(spec *spec, value string) error {
+	shown := value
+	if spec.secret {
+		shown = secretMask
+	}
+	if len(spec.choices) > 0 && !containsString(spec.choices, value) {
+		return fmt.Errorf("invalid choice %q (choose from %s)", shown, strings.Join(spec.choices, ", "))
+	}
+	if spec.pattern != nil && !spec.pattern.MatchString(value) {
+		if spec.patternMsg != "" {
+			return fmt.Errorf("invalid value %q: %s", shown, spec.patternMsg)
+		}
+		return fmt.Errorf("%q does not match the pattern %s", shown, spec.pattern)
+	}
+	if spec.min.IsValid() || spec.max.IsValid() {
+		bound := spec.min
+		if !bound.IsValid() {
+			bound = spec.max
+		}
+		v := reflect.New(bound.Type()).Elem()
+		if err := scalar.ParseValue(v, value); err != nil {
+			// leave it to the caller to report values that cannot be parsed
+			return nil
+		}
+		return checkRange(spec, v)
+	}
+	return nil
+}
+
+// checkRange checks a parsed value, or an element of a slice, against the
+// bounds given by the min and max tags
+func checkRange(spec *spec, v reflect.Value) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	shown := formatNumber(v)
+	if spec.secret {
+		shown = secretMask
+	}
+	if spec.min.IsValid() && lessValue(v, spec.min) {
+		return fmt.Errorf("%s is less than the minimum of %s", shown, formatNumber(spec.min))
+	}
+	if spec.max.IsValid() && lessValue(spec.max, v) {
+		return fmt.Errorf("%s is greater than the maximum of %s", shown, formatNumber(spec.max))
+	}
+	return nil
+}
+
+// parseBound parses the value of a min or max tag as the type of the field,
+// or of the elements of a slice field
+func parseBound(t reflect.Type, bound string) (reflect.Value, error) {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if !isNumber(t) {
+		return reflect.Value{}, fmt.Errorf("min and max are only supported for numbers and durations")
+	}
+	v := reflect.New(t).Elem()
+	if err := scalar.ParseValue(v, bound); err != nil {
+		return reflect.Value{}, err
+	}
+	return v, nil
+}
+
+// isNumber returns true if t is an integer or floating point type, which
+// includes time.Duration
+func isNumber(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// formatNumber formats a number for error messages and help text, using the
+// String method of types such as time.Duration
+func formatNumber(v reflect.Value) string {
+	return fmt.Sprint(v.Interface())
+}
+
+// compilePattern compiles the value of a pattern tag, which is only supported
+// for strings and slices of strings
+func compilePattern(t reflect.Type, pattern string) (*regexp.Regexp, error) {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.String {
+		return nil, fmt.Errorf("pattern is only supported for strings")
+	}
+	return regexp.Compile(pattern)
+}
+
+// parseChoices splits the value of a choices tag
+func parseChoices(tag string) []string {
+	var choices []string
+	for _, choice := range strings.Split(tag, ",") {
+		if choice = strings.TrimSpace(choice); choice != "" {
+			choices = append(choices, choice)
+		}
+	}
+	return choices
+}
+
+// choicesOf returns the values allowed by a type, or by the elements of a
+// slice type, if the type implements Enumerated
+func choicesOf(t reflect.Type) []string {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if !reflect.PtrTo(t).Implements(enumeratedType) {
+		return nil
+	}
+	return reflect.New(t).Interface().(Enumerated).Choices()
+}
+
+// containsString returns true if s is one of the given strings
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
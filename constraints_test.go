@@ -0,0 +1,254 @@
+package arg
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type outputFormat string
+
+func (outputFormat) Choices() []string {
+	return []string{"json", "yaml", "table"}
+}
+
+func TestChoices(t *testing.T) {
+	var args struct {
+		Format string   `choices:"json,yaml,table"`
+		Levels []string `choices:"debug, info"`
+		Mode   string   `arg:"positional" choices:"fast,slow"`
+	}
+	err := parse("slow --format yaml --levels debug info", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "yaml", args.Format)
+	assert.Equal(t, []string{"debug", "info"}, args.Levels)
+	assert.Equal(t, "slow", args.Mode)
+}
+
+func TestChoicesInvalid(t *testing.T) {
+	var args struct {
+		Format string   `choices:"json,yaml,table"`
+		Levels []string `choices:"debug,info"`
+		Mode   string   `arg:"positional" choices:"fast,slow"`
+	}
+	err := parse("--format xml", &args)
+	assert.EqualError(t, err, `error processing --format: invalid choice "xml" (choose from json, yaml, table)`)
+
+	err = parse("--levels debug warn", &args)
+	assert.EqualError(t, err, `error processing --levels: invalid choice "warn" (choose from debug, info)`)
+
+	err = parse("medium", &args)
+	assert.EqualError(t, err, `error processing mode: invalid choice "medium" (choose from fast, slow)`)
+}
+
+func TestChoicesFromEnv(t *testing.T) {
+	var args struct {
+		Format string `arg:"env" choices:"json,yaml"`
+	}
+	setenv(t, "FORMAT", "xml")
+	defer os.Unsetenv("FORMAT")
+
+	os.Args = []string{"example"}
+	err := parse("", &args)
+	assert.EqualError(t, err, `error processing environment variable FORMAT: invalid choice "xml" (choose from json, yaml)`)
+}
+
+func TestChoicesDefault(t *testing.T) {
+	var args struct {
+		Format string `default:"json" choices:"json,yaml"`
+	}
+	err := parse("", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "json", args.Format)
+
+	var bad struct {
+		Format string `default:"xml" choices:"json,yaml"`
+	}
+	_, err = NewParser(Config{}, &bad)
+	assert.EqualError(t, err, `.Format: invalid default value "xml": invalid choice "xml" (choose from json, yaml)`)
+}
+
+func TestChoicesFromInterface(t *testing.T) {
+	var args struct {
+		Format  outputFormat
+		Formats []outputFormat
+		Ptr     *outputFormat
+	}
+	err := parse("--format table --formats json yaml --ptr json", &args)
+	require.NoError(t, err)
+	assert.Equal(t, outputFormat("table"), args.Format)
+	assert.Equal(t, []outputFormat{"json", "yaml"}, args.Formats)
+	require.NotNil(t, args.Ptr)
+	assert.Equal(t, outputFormat("json"), *args.Ptr)
+
+	err = parse("--format csv", &args)
+	assert.EqualError(t, err, `error processing --format: invalid choice "csv" (choose from json, yaml, table)`)
+}
+
+func TestChoicesTagOverridesInterface(t *testing.T) {
+	var args struct {
+		Format outputFormat `choices:"json"`
+	}
+	err := parse("--format yaml", &args)
+	assert.EqualError(t, err, `error processing --format: invalid choice "yaml" (choose from json)`)
+}
+
+func TestChoicesInvalidTag(t *testing.T) {
+	var empty struct {
+		Format string `choices:""`
+	}
+	_, err := NewParser(Config{}, &empty)
+	assert.EqualError(t, err, ".Format: choices must not be empty")
+
+	var onMap struct {
+		Labels map[string]string `choices:"a,b"`
+	}
+	_, err = NewParser(Config{}, &onMap)
+	assert.EqualError(t, err, ".Labels: choices are not supported for maps")
+}
+
+func TestMinMax(t *testing.T) {
+	var args struct {
+		Workers int           `min:"1" max:"64"`
+		Port    uint16        `min:"1024"`
+		Ratio   float64       `max:"1"`
+		Timeout time.Duration `min:"1s" max:"1m"`
+		Sizes   []int         `min:"0"`
+		Limit   *int          `max:"10"`
+	}
+	err := parse("--workers 64 --port 8080 --ratio 0.5 --timeout 30s --sizes 0 5 --limit 10", &args)
+	require.NoError(t, err)
+	assert.Equal(t, 64, args.Workers)
+	assert.Equal(t, uint16(8080), args.Port)
+	assert.Equal(t, 30*time.Second, args.Timeout)
+	assert.Equal(t, []int{0, 5}, args.Sizes)
+
+	err = parse("--workers 0", &args)
+	assert.EqualError(t, err, "error processing --workers: 0 is less than the minimum of 1")
+
+	err = parse("--workers 65", &args)
+	assert.EqualError(t, err, "error processing --workers: 65 is greater than the maximum of 64")
+
+	err = parse("--ratio 1.5", &args)
+	assert.EqualError(t, err, "error processing --ratio: 1.5 is greater than the maximum of 1")
+
+	err = parse("--timeout 2m", &args)
+	assert.EqualError(t, err, "error processing --timeout: 2m0s is greater than the maximum of 1m0s")
+
+	err = parse("--sizes=-1", &args)
+	assert.EqualError(t, err, "error processing --sizes=-1: -1 is less than the minimum of 0")
+
+	err = parse("--limit 11", &args)
+	assert.EqualError(t, err, "error processing --limit: 11 is greater than the maximum of 10")
+
+	err = parse("--workers x", &args)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error processing --workers: strconv.ParseInt")
+}
+
+func TestMinMaxFromEnv(t *testing.T) {
+	var args struct {
+		Workers int `arg:"env" min:"1"`
+	}
+	setenv(t, "WORKERS", "0")
+	defer os.Unsetenv("WORKERS")
+
+	os.Args = []string{"example"}
+	err := parse("", &args)
+	assert.EqualError(t, err, "error processing environment variable WORKERS: 0 is less than the minimum of 1")
+}
+
+func TestMaxCounter(t *testing.T) {
+	var args struct {
+		Verbose int `arg:"-v,counter" max:"2"`
+	}
+	err := parse("-vv", &args)
+	require.NoError(t, err)
+	assert.Equal(t, 2, args.Verbose)
+
+	err = parse("-vvv", &args)
+	assert.EqualError(t, err, "error processing -v: 3 is greater than the maximum of 2")
+}
+
+func TestMinMaxInvalidTags(t *testing.T) {
+	var onString struct {
+		Name string `min:"1"`
+	}
+	_, err := NewParser(Config{}, &onString)
+	assert.EqualError(t, err, `.Name: invalid min value "1": min and max are only supported for numbers and durations`)
+
+	var badBound struct {
+		Workers int `max:"many"`
+	}
+	_, err = NewParser(Config{}, &badBound)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `.Workers: invalid max value "many"`)
+
+	var reversed struct {
+		Workers int `min:"10" max:"1"`
+	}
+	_, err = NewParser(Config{}, &reversed)
+	assert.EqualError(t, err, ".Workers: min is greater than max")
+
+	var badDefault struct {
+		Workers int `min:"1" default:"0"`
+	}
+	_, err = NewParser(Config{}, &badDefault)
+	assert.EqualError(t, err, `.Workers: invalid default value "0": 0 is less than the minimum of 1`)
+}
+
+func TestPattern(t *testing.T) {
+	var args struct {
+		Cluster string   `pattern:"^[a-z0-9-]+$"`
+		Tags    []string `pattern:"^v[0-9]+$" patternhelp:"tags look like v1, v2, ..."`
+		SHA     *string  `pattern:"^[0-9a-f]{7,40}$"`
+	}
+	err := parse("--cluster prod-1 --tags v1 v2 --sha abc1234", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "prod-1", args.Cluster)
+	assert.Equal(t, []string{"v1", "v2"}, args.Tags)
+	require.NotNil(t, args.SHA)
+	assert.Equal(t, "abc1234", *args.SHA)
+
+	err = parse("--cluster Prod_1", &args)
+	assert.EqualError(t, err, `error processing --cluster: "Prod_1" does not match the pattern ^[a-z0-9-]+$`)
+
+	err = parse("--tags v1 latest", &args)
+	assert.EqualError(t, err, `error processing --tags: invalid value "latest": tags look like v1, v2, ...`)
+}
+
+func TestPatternFromEnvAndDefault(t *testing.T) {
+	var args struct {
+		Cluster string `arg:"env:PATTERN_TEST_CLUSTER" pattern:"^[a-z]+$"`
+	}
+	setenv(t, "PATTERN_TEST_CLUSTER", "UPPER")
+	defer os.Unsetenv("PATTERN_TEST_CLUSTER")
+
+	os.Args = []string{"example"}
+	err := parse("", &args)
+	assert.EqualError(t, err, `error processing environment variable PATTERN_TEST_CLUSTER: "UPPER" does not match the pattern ^[a-z]+$`)
+
+	var withDefault struct {
+		Cluster string `default:"UPPER" pattern:"^[a-z]+$"`
+	}
+	_, err = NewParser(Config{}, &withDefault)
+	assert.EqualError(t, err, `.Cluster: invalid default value "UPPER": "UPPER" does not match the pattern ^[a-z]+$`)
+}
+
+func TestPatternInvalidTag(t *testing.T) {
+	var badRegex struct {
+		Cluster string `pattern:"[a-z"`
+	}
+	_, err := NewParser(Config{}, &badRegex)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `.Cluster: invalid pattern "[a-z": error parsing regexp`)
+
+	var notString struct {
+		Port int `pattern:"^[0-9]+$"`
+	}
+	_, err = NewParser(Config{}, &notString)
+	assert.EqualError(t, err, `.Port: invalid pattern "^[0-9]+$": pattern is only supported for strings`)
+}
@@ -17,7 +17,8 @@
 // The fastest way to see how to use go-arg is to read the examples below.
 //
 // Fields can be bool, string, any float type, or any signed or unsigned integer type.
-// They can also be slices of any of the above, or slices of pointers to any of the above.
+// They can also be slices of any of the above, or slices of pointers to any of the above,
+// or maps whose keys and values are any of the above.
 //
 // Tags can be specified using the `arg` and `help` tag names:
 //
@@ -0,0 +1,193 @@
+package arg
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// LoadDotEnv reads variables from one or more dotenv files, without changing
+// the environment of the process. Variables in later files override those in
+// earlier ones.
+//
+// Each line of a file has the form KEY=VALUE, optionally preceded by "export".
+// Blank lines and lines starting with "#" are ignored, as is anything after a
+// "#" that follows whitespace in an unquoted value. Values in single quotes
+// are taken literally. Values in double quotes may contain escapes such as
+// "\n" and may span several lines. References such as ${VAR} or $VAR in
+// unquoted and double-quoted values are replaced with the value of the
+// environment variable, or else the variable defined earlier in the files.
+func LoadDotEnv(files ...string) (map[string]string, error) {
+	return loadDotEnv(files, os.LookupEnv, false)
+}
+
+// loadDotEnv reads variables from dotenv files, using lookup to resolve
+// references to variables. Missing files are skipped if skipMissing is true.
+func loadDotEnv(files []string, lookup func(string) (string, bool), skipMissing bool) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, name := range files {
+		buf, err := ioutil.ReadFile(name)
+		if err != nil {
+			if skipMissing && os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("error reading dotenv file %s: %v", name, err)
+		}
+		if err := parseDotEnv(name, string(buf), lookup, vars); err != nil {
+			return nil, err
+		}
+	}
+	return vars, nil
+}
+
+// parseDotEnv parses the contents of a dotenv file into vars
+func parseDotEnv(name, content string, lookup func(string) (string, bool), vars map[string]string) error {
+	resolve := func(key string) string {
+		if value, ok := lookup(key); ok {
+			return value
+		}
+		return vars[key]
+	}
+
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineno := i + 1
+		line := strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "export ") || strings.HasPrefix(line, "export\t") {
+			line = strings.TrimLeft(line[len("export"):], " \t")
+		}
+
+		pos := strings.Index(line, "=")
+		if pos == -1 {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", name, lineno)
+		}
+		key := strings.TrimSpace(line[:pos])
+		if !isEnvName(key) {
+			return fmt.Errorf("%s:%d: invalid variable name %q", name, lineno, key)
+		}
+		rest := strings.TrimLeft(line[pos+1:], " \t")
+
+		var value string
+		var err error
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			quote := rest[0]
+			body := rest[1:]
+			end := closingQuote(body, quote)
+			for end == -1 {
+				// the value continues on the next line
+				i++
+				if i == len(lines) {
+					return fmt.Errorf("%s:%d: unterminated quote", name, lineno)
+				}
+				body += "\n" + strings.TrimSuffix(lines[i], "\r")
+				end = closingQuote(body, quote)
+			}
+			trailing := strings.TrimSpace(body[end+1:])
+			if trailing != "" && !strings.HasPrefix(trailing, "#") {
+				return fmt.Errorf("%s:%d: unexpected %q after closing quote", name, lineno, trailing)
+			}
+			value = body[:end]
+			if quote == '"' {
+				value, err = expandDotEnv(value, true, resolve)
+			}
+		} else {
+			// strip a comment that follows whitespace
+			for j := 1; j < len(rest); j++ {
+				if rest[j] == '#' && (rest[j-1] == ' ' || rest[j-1] == '\t') {
+					rest = rest[:j]
+					break
+				}
+			}
+			value, err = expandDotEnv(strings.TrimSpace(rest), false, resolve)
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", name, lineno, err)
+		}
+		vars[key] = value
+	}
+	return nil
+}
+
+// closingQuote finds the quote that ends a quoted value, or returns -1. Inside
+// double quotes a quote can be escaped with a backslash.
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// expandDotEnv replaces references to variables in a value, and also
+// backslash escapes if escapes is true
+func expandDotEnv(s string, escapes bool, resolve func(string) string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && escapes && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\', '$':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		case c == '$' && i+1 < len(s) && s[i+1] == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end == -1 {
+				return "", errors.New("unterminated ${")
+			}
+			key := s[i+2 : i+2+end]
+			if !isEnvName(key) {
+				return "", fmt.Errorf("invalid variable name %q", key)
+			}
+			b.WriteString(resolve(key))
+			i += 2 + end
+		case c == '$' && i+1 < len(s) && isEnvNameStart(s[i+1]):
+			j := i + 1
+			for j < len(s) && (isEnvNameStart(s[j]) || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			b.WriteString(resolve(s[i+1 : j]))
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// isEnvName returns true if s is a valid name for a variable in a dotenv file
+func isEnvName(s string) bool {
+	if s == "" || !isEnvNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isEnvNameStart(s[i]) && (s[i] < '0' || s[i] > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// isEnvNameStart returns true if c can start the name of a variable
+func isEnvNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,130 @@
+package arg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadDotEnv(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		".env": `# database settings
+DB_HOST=localhost
+export DB_PORT = 5432
+DB_NAME=app # trailing comment
+DB_URL=postgres://${DB_HOST}:$DB_PORT/${DB_NAME}
+SINGLE='literal $DB_HOST # not a comment'
+DOUBLE="line one\nline \"two\"" # comment
+MULTI="first
+second"
+EMPTY=
+HASH=a#b
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	vars, err := LoadDotEnv(filepath.Join(dir, ".env"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"DB_HOST": "localhost",
+		"DB_PORT": "5432",
+		"DB_NAME": "app",
+		"DB_URL":  "postgres://localhost:5432/app",
+		"SINGLE":  "literal $DB_HOST # not a comment",
+		"DOUBLE":  "line one\nline \"two\"",
+		"MULTI":   "first\nsecond",
+		"EMPTY":   "",
+		"HASH":    "a#b",
+	}, vars)
+}
+
+func TestLoadDotEnvLaterFilesOverride(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		".env":       "A=1\nB=2\n",
+		".env.local": "B=3\nC=${A}${B}\n",
+	})
+	defer os.RemoveAll(dir)
+
+	vars, err := LoadDotEnv(filepath.Join(dir, ".env"), filepath.Join(dir, ".env.local"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"A": "1", "B": "3", "C": "13"}, vars)
+}
+
+func TestLoadDotEnvInterpolatesEnvironment(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		".env": "DOTENV_TEST_HOME=${DOTENV_TEST_USER}/home\n",
+	})
+	defer os.RemoveAll(dir)
+	setenv(t, "DOTENV_TEST_USER", "alice")
+	defer os.Unsetenv("DOTENV_TEST_USER")
+
+	vars, err := LoadDotEnv(filepath.Join(dir, ".env"))
+	require.NoError(t, err)
+	assert.Equal(t, "alice/home", vars["DOTENV_TEST_HOME"])
+}
+
+func TestLoadDotEnvErrors(t *testing.T) {
+	for content, msg := range map[string]string{
+		"A=1\nnot a pair\n":    ":2: expected KEY=VALUE",
+		"1A=x\n":               ":1: invalid variable name \"1A\"",
+		"A=\"open\nstill open": ":1: unterminated quote",
+		"A='x' y\n":            ":1: unexpected \"y\" after closing quote",
+		"A=${B\n":              ":1: unterminated ${",
+	} {
+		dir := writeTempFiles(t, map[string]string{".env": content})
+		name := filepath.Join(dir, ".env")
+		_, err := LoadDotEnv(name)
+		os.RemoveAll(dir)
+		assert.EqualError(t, err, name+msg, "parsing %q", content)
+	}
+}
+
+func TestLoadDotEnvMissingFile(t *testing.T) {
+	_, err := LoadDotEnv("/does/not/exist/.env")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error reading dotenv file /does/not/exist/.env")
+}
+
+func TestDotEnvFiles(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		".env": "WORKERS=4\nNAME=from-dotenv\nPASSWORD_FILE=" + "${SECRET_DIR}/pw\n",
+		"pw":   "hunter2\n",
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Workers  int    `arg:"env"`
+		Name     string `arg:"env"`
+		Password string `arg:"env,secret"`
+	}
+	env := map[string]string{"NAME": "from-env", "SECRET_DIR": dir}
+	config := Config{
+		DotEnvFiles: []string{filepath.Join(dir, ".env"), filepath.Join(dir, "missing.env")},
+		LookupEnv: func(key string) (string, bool) {
+			value, ok := env[key]
+			return value, ok
+		},
+	}
+	_, err := pparseconfig(config, "", &args)
+	require.NoError(t, err)
+	assert.Equal(t, 4, args.Workers)
+	assert.Equal(t, "from-env", args.Name)
+	assert.Equal(t, "hunter2", args.Password)
+	_, found := os.LookupEnv("WORKERS")
+	assert.False(t, found)
+}
+
+func TestDotEnvFilesError(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{".env": "oops\n"})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Workers int `arg:"env"`
+	}
+	name := filepath.Join(dir, ".env")
+	_, err := pparseconfig(Config{DotEnvFiles: []string{name}}, "", &args)
+	assert.EqualError(t, err, name+":1: expected KEY=VALUE")
+}
@@ -122,14 +122,14 @@ func Example_helpText() {
 	MustParse(&args)
 
 	// output:
-	// Usage: example [--verbose] [--dataset DATASET] [--optimize OPTIMIZE] INPUT [OUTPUT [OUTPUT ...]]
+	// Usage: example [--[no-]verbose] [--dataset DATASET] [--optimize OPTIMIZE] INPUT [OUTPUT [OUTPUT ...]]
 	//
 	// Positional arguments:
 	//   INPUT
 	//   OUTPUT
 	//
 	// Options:
-	//   --verbose, -v          verbosity level
+	//   --[no-]verbose, -v     verbosity level
 	//   --dataset DATASET      dataset to use
 	//   --optimize OPTIMIZE, -O OPTIMIZE
 	//                          optimization level
@@ -162,10 +162,10 @@ func Example_helpTextWithSubcommand() {
 	MustParse(&args)
 
 	// output:
-	// Usage: example [--verbose]
+	// Usage: example [--[no-]verbose]
 	//
 	// Options:
-	//   --verbose
+	//   --[no-]verbose
 	//   --help, -h             display this help and exit
 	//
 	// Commands:
@@ -228,7 +228,7 @@ func Example_errorText() {
 	MustParse(&args)
 
 	// output:
-	// Usage: example [--verbose] [--dataset DATASET] [--optimize OPTIMIZE] INPUT [OUTPUT [OUTPUT ...]]
+	// Usage: example [--[no-]verbose] [--dataset DATASET] [--optimize OPTIMIZE] INPUT [OUTPUT [OUTPUT ...]]
 	// error: error processing --optimize: strconv.ParseInt: parsing "INVALID": invalid syntax
 }
 
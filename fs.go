@@ -0,0 +1,161 @@
+package arg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// ExistingFile is a path to a file that must exist when the argument is
+// parsed. A leading "~" is expanded to the home directory.
+type ExistingFile string
+
+// ExistingDir is a path to a directory that must exist when the argument is
+// parsed. A leading "~" is expanded to the home directory.
+type ExistingDir string
+
+// NewFile is a path to a file that can be written, which means either that it
+// is an existing file that can be opened for writing or that it is in an
+// existing directory in which files can be created. A leading "~" is expanded
+// to the home directory.
+type NewFile string
+
+// UnmarshalText checks that the file exists
+func (f *ExistingFile) UnmarshalText(b []byte) error {
+	path, err := expandHome(string(b))
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("file %s does not exist", path)
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory, not a file", path)
+	}
+	*f = ExistingFile(path)
+	return nil
+}
+
+// UnmarshalText checks that the directory exists
+func (d *ExistingDir) UnmarshalText(b []byte) error {
+	path, err := expandHome(string(b))
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("directory %s does not exist", path)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	*d = ExistingDir(path)
+	return nil
+}
+
+// UnmarshalText checks that the file can be written
+func (f *NewFile) UnmarshalText(b []byte) error {
+	path, err := expandHome(string(b))
+	if err != nil {
+		return err
+	}
+	if err := checkWritable(path); err != nil {
+		return err
+	}
+	*f = NewFile(path)
+	return nil
+}
+
+// pathType is implemented by the types whose values are paths, so that the
+// parser can resolve relative paths against Config.BaseDir
+type pathType interface {
+	isPath()
+}
+
+func (ExistingFile) isPath() {}
+func (ExistingDir) isPath()  {}
+func (NewFile) isPath()      {}
+
+var pathTypeType = reflect.TypeOf((*pathType)(nil)).Elem()
+
+// isPathType returns true if the type, or the elements of a slice type, hold
+// paths that are resolved against Config.BaseDir
+func isPathType(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Implements(pathTypeType)
+}
+
+// resolvePath expands a leading "~" and makes a relative path relative to
+// base, if base is not empty
+func resolvePath(path, base string) string {
+	if expanded, err := expandHome(path); err == nil {
+		path = expanded
+	}
+	if base == "" || path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+// expandHome replaces a leading "~" in a path with the home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		return "", fmt.Errorf("cannot expand %s: $HOME is not set", path)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// checkWritable checks that a file can be opened for writing, or else created
+func checkWritable(path string) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory, not a file", path)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("%s is not writable: %v", path, err)
+		}
+		return f.Close()
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	info, err = os.Stat(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("directory %s does not exist", dir)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := ioutil.TempFile(dir, ".arg-check-")
+	if err != nil {
+		return fmt.Errorf("cannot create files in %s: %v", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
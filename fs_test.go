@@ -0,0 +1,185 @@
+package arg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExistingFile(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{"in.txt": "hello"})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Input  ExistingFile
+		Inputs []ExistingFile
+	}
+	in := filepath.Join(dir, "in.txt")
+	err := parse("--input "+in+" --inputs "+in+" "+in, &args)
+	require.NoError(t, err)
+	assert.Equal(t, ExistingFile(in), args.Input)
+	assert.Equal(t, []ExistingFile{ExistingFile(in), ExistingFile(in)}, args.Inputs)
+
+	missing := filepath.Join(dir, "missing.txt")
+	err = parse("--input "+missing, &args)
+	assert.EqualError(t, err, "error processing --input: file "+missing+" does not exist")
+
+	err = parse("--input "+dir, &args)
+	assert.EqualError(t, err, "error processing --input: "+dir+" is a directory, not a file")
+}
+
+func TestExistingDir(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{"in.txt": "hello"})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Dir *ExistingDir
+	}
+	err := parse("--dir "+dir, &args)
+	require.NoError(t, err)
+	require.NotNil(t, args.Dir)
+	assert.Equal(t, ExistingDir(dir), *args.Dir)
+
+	in := filepath.Join(dir, "in.txt")
+	err = parse("--dir "+in, &args)
+	assert.EqualError(t, err, "error processing --dir: "+in+" is not a directory")
+
+	missing := filepath.Join(dir, "missing")
+	err = parse("--dir "+missing, &args)
+	assert.EqualError(t, err, "error processing --dir: directory "+missing+" does not exist")
+}
+
+func TestNewFile(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{"existing.txt": "hello"})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Output NewFile
+	}
+	for _, name := range []string{"existing.txt", "new.txt"} {
+		out := filepath.Join(dir, name)
+		err := parse("--output "+out, &args)
+		require.NoError(t, err)
+		assert.Equal(t, NewFile(out), args.Output)
+	}
+
+	// checking that the directory is writable must not leave files behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	out := filepath.Join(dir, "missing", "out.txt")
+	err = parse("--output "+out, &args)
+	assert.EqualError(t, err, "error processing --output: directory "+filepath.Join(dir, "missing")+" does not exist")
+
+	err = parse("--output "+dir, &args)
+	assert.EqualError(t, err, "error processing --output: "+dir+" is a directory, not a file")
+}
+
+func TestPathHomeExpansion(t *testing.T) {
+	home := writeTempFiles(t, map[string]string{"in.txt": "hello"})
+	defer os.RemoveAll(home)
+	oldHome := os.Getenv("HOME")
+	setenv(t, "HOME", home)
+	defer os.Setenv("HOME", oldHome)
+
+	var args struct {
+		Input ExistingFile
+		Home  ExistingDir
+	}
+	err := parse("--input ~/in.txt --home ~", &args)
+	require.NoError(t, err)
+	assert.Equal(t, ExistingFile(filepath.Join(home, "in.txt")), args.Input)
+	assert.Equal(t, ExistingDir(home), args.Home)
+
+	os.Unsetenv("HOME")
+	err = parse("--home ~", &args)
+	assert.EqualError(t, err, "error processing --home: cannot expand ~: $HOME is not set")
+}
+
+func TestPathBaseDir(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{"app.json": "{}"})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Config ExistingFile   `default:"app.json"`
+		Extra  []ExistingFile `arg:"env:PATH_TEST_EXTRA"`
+		Out    NewFile
+		Name   string
+	}
+	env := map[string]string{"PATH_TEST_EXTRA": "app.json"}
+	config := Config{
+		BaseDir: dir,
+		LookupEnv: func(key string) (string, bool) {
+			value, ok := env[key]
+			return value, ok
+		},
+	}
+	_, err := pparseconfig(config, "--out out.txt --name app.json", &args)
+	require.NoError(t, err)
+	assert.Equal(t, ExistingFile(filepath.Join(dir, "app.json")), args.Config)
+	assert.Equal(t, []ExistingFile{ExistingFile(filepath.Join(dir, "app.json"))}, args.Extra)
+	assert.Equal(t, NewFile(filepath.Join(dir, "out.txt")), args.Out)
+	assert.Equal(t, "app.json", args.Name)
+}
+
+func TestPathDefaultCheckedWhenParsing(t *testing.T) {
+	var args struct {
+		Config ExistingFile `default:"does-not-exist.json"`
+	}
+	p, err := NewParser(Config{BaseDir: os.TempDir()}, &args)
+	require.NoError(t, err)
+
+	err = p.Parse(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error processing default value for config: file ")
+}
+
+func TestPathDefaultResolvedAgainstBaseDir(t *testing.T) {
+	dir := writeTempFiles(t, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "logs"), 0755))
+
+	var args struct {
+		Log    NewFile    `default:"logs/out.log"`
+		Input  InputFile  `default:"-"`
+		Output OutputFile `default:"logs/out.txt"`
+	}
+	p, err := NewParser(Config{BaseDir: dir}, &args)
+	require.NoError(t, err)
+
+	// nothing is created in the directory until the options are written
+	entries, err := ioutil.ReadDir(filepath.Join(dir, "logs"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	require.NoError(t, p.Parse(nil))
+	assert.Equal(t, NewFile(filepath.Join(dir, "logs", "out.log")), args.Log)
+	assert.Equal(t, filepath.Join(dir, "logs", "out.txt"), args.Output.Name)
+	assert.NoError(t, p.Close())
+}
+
+func TestPathDefaultOverridden(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{"in.txt": "hello"})
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "in.txt")
+
+	var args struct {
+		In ExistingFile `arg:"env:PATH_TEST_IN" default:"/does/not/exist.txt"`
+	}
+	err := parse("--in "+in, &args)
+	require.NoError(t, err)
+	assert.Equal(t, ExistingFile(in), args.In)
+
+	args.In = ""
+	setenv(t, "PATH_TEST_IN", in)
+	defer os.Unsetenv("PATH_TEST_IN")
+	os.Args = []string{"example"}
+	err = parse("", &args)
+	require.NoError(t, err)
+	assert.Equal(t, ExistingFile(in), args.In)
+}
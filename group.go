@@ -0,0 +1,109 @@
+package arg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the tags that put an option in a group, in the order they are checked
+var groupKinds = []string{"xor", "oneof", "together"}
+
+// group is a set of options that must be given alone or together
+type group struct {
+	kind    string // "xor" for at most one, "oneof" for exactly one, "together" for all or none
+	name    string
+	members []*spec
+}
+
+// addToGroup adds an option to the group of the given kind and name,
+// creating the group if necessary
+func (cmd *command) addToGroup(kind, name string, member *spec) {
+	for _, g := range cmd.groups {
+		if g.kind == kind && g.name == name {
+			g.members = append(g.members, member)
+			member.group = g
+			return
+		}
+	}
+	g := &group{kind: kind, name: name, members: []*spec{member}}
+	cmd.groups = append(cmd.groups, g)
+	member.group = g
+}
+
+// checkGroups checks the groups of the current command and its ancestors
+// against the options that were given
+func (p *Parser) checkGroups() error {
+	for cmd := p.curCmd; cmd != nil; cmd = cmd.parent {
+		for _, g := range cmd.groups {
+			if err := g.check(p.wasPresent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// givenInGroup returns true if another member of the xor or oneof group of an
+// option was given a value by something other than a config file, in which
+// case that value takes the place of the option's value from the config file
+func (p *Parser) givenInGroup(spec *spec) bool {
+	if spec.group == nil || spec.group.kind == "together" {
+		return false
+	}
+	for _, member := range spec.group.members {
+		if member == spec || !p.wasPresent[member] {
+			continue
+		}
+		if rec, ok := p.origins[member]; ok && rec.Origin != OriginConfigFile {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error naming every member of the group if the options
+// that were given break its rule
+func (g *group) check(wasPresent map[*spec]bool) error {
+	var n int
+	names := make([]string, len(g.members))
+	for i, spec := range g.members {
+		names[i] = "--" + spec.long
+		if wasPresent[spec] {
+			n++
+		}
+	}
+	list := strings.Join(names, ", ")
+
+	switch g.kind {
+	case "xor":
+		if n > 1 {
+			return fmt.Errorf("only one of %s can be given", list)
+		}
+	case "oneof":
+		if n != 1 {
+			return fmt.Errorf("exactly one of %s is required", list)
+		}
+	case "together":
+		if n > 0 && n < len(g.members) {
+			return fmt.Errorf("%s must be given together", list)
+		}
+	}
+	return nil
+}
+
+// synopsis returns the usage text for the group, such as
+// "(--file FILE | --url URL)"
+func (g *group) synopsis() string {
+	parts := make([]string, len(g.members))
+	for i, spec := range g.members {
+		parts[i] = synopsis(spec, usageForm(spec))
+	}
+	switch g.kind {
+	case "oneof":
+		return "(" + strings.Join(parts, " | ") + ")"
+	case "xor":
+		return "[" + strings.Join(parts, " | ") + "]"
+	default:
+		return "[" + strings.Join(parts, " ") + "]"
+	}
+}
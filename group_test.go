@@ -0,0 +1,153 @@
+package arg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXorGroup(t *testing.T) {
+	var args struct {
+		File string `xor:"source"`
+		URL  string `xor:"source"`
+	}
+	err := parse("", &args)
+	require.NoError(t, err)
+
+	err = parse("--file a", &args)
+	require.NoError(t, err)
+
+	err = parse("--file a --url b", &args)
+	assert.EqualError(t, err, "only one of --file, --url can be given")
+}
+
+func TestOneofGroup(t *testing.T) {
+	var args struct {
+		File  string `oneof:"source"`
+		URL   string `oneof:"source"`
+		Stdin bool   `oneof:"source"`
+	}
+	err := parse("--stdin", &args)
+	require.NoError(t, err)
+
+	err = parse("", &args)
+	assert.EqualError(t, err, "exactly one of --file, --url, --stdin is required")
+
+	err = parse("--file a --stdin", &args)
+	assert.EqualError(t, err, "exactly one of --file, --url, --stdin is required")
+}
+
+func TestTogetherGroup(t *testing.T) {
+	var args struct {
+		User     string `together:"auth"`
+		Password string `together:"auth"`
+	}
+	err := parse("", &args)
+	require.NoError(t, err)
+
+	err = parse("--user u --password p", &args)
+	require.NoError(t, err)
+
+	err = parse("--user u", &args)
+	assert.EqualError(t, err, "--user, --password must be given together")
+}
+
+func TestGroupCountsEnv(t *testing.T) {
+	var args struct {
+		File string `arg:"env:GROUP_TEST_FILE" xor:"source"`
+		URL  string `xor:"source"`
+	}
+	setenv(t, "GROUP_TEST_FILE", "a")
+	defer os.Unsetenv("GROUP_TEST_FILE")
+
+	os.Args = []string{"example"}
+	err := parse("--url b", &args)
+	assert.EqualError(t, err, "only one of --file, --url can be given")
+}
+
+func TestGroupIgnoresDefaults(t *testing.T) {
+	var args struct {
+		File string `xor:"source" default:"a"`
+		URL  string `xor:"source"`
+	}
+	err := parse("--url b", &args)
+	require.NoError(t, err)
+}
+
+func TestGroupCommandLineOverridesConfigFile(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"app.json":  `{"url": "u", "user": "me"}`,
+		"both.json": `{"file": "f", "url": "u"}`,
+	})
+	defer os.RemoveAll(dir)
+
+	type groupArgs struct {
+		Config   string `arg:"config"`
+		File     string `xor:"source"`
+		URL      string `xor:"source"`
+		User     string `together:"auth"`
+		Password string `together:"auth"`
+	}
+	var args groupArgs
+	err := parse("--config "+filepath.Join(dir, "app.json")+" --file a --password p", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "a", args.File)
+	assert.Equal(t, "", args.URL)
+	assert.Equal(t, "me", args.User)
+
+	// a config file that sets both is still rejected
+	args = groupArgs{}
+	err = parse("--config "+filepath.Join(dir, "both.json"), &args)
+	assert.EqualError(t, err, "only one of --file, --url can be given")
+}
+
+func TestGroupOnSubcommand(t *testing.T) {
+	type fetchCmd struct {
+		File string `oneof:"source"`
+		URL  string `oneof:"source"`
+	}
+	var args struct {
+		Fetch *fetchCmd `arg:"subcommand"`
+		Other *struct{} `arg:"subcommand"`
+	}
+	err := parse("other", &args)
+	require.NoError(t, err)
+
+	err = parse("fetch", &args)
+	assert.EqualError(t, err, "exactly one of --file, --url is required")
+}
+
+func TestGroupWithSubcommandActive(t *testing.T) {
+	var a struct {
+		Sub *struct{} `arg:"subcommand"`
+	}
+	var b struct {
+		File string `xor:"src"`
+		URL  string `xor:"src"`
+	}
+	p, err := NewParser(Config{}, &a, &b)
+	require.NoError(t, err)
+
+	err = p.Parse([]string{"--file", "f", "--url", "u"})
+	assert.EqualError(t, err, "only one of --file, --url can be given")
+
+	err = p.Parse([]string{"--file", "f", "--url", "u", "sub"})
+	assert.EqualError(t, err, "only one of --file, --url can be given")
+}
+
+func TestGroupInvalid(t *testing.T) {
+	var twoGroups struct {
+		File string `xor:"a" together:"b"`
+	}
+	_, err := NewParser(Config{}, &twoGroups)
+	assert.EqualError(t, err, ".File: options can only belong to one group")
+
+	var required struct {
+		File string `arg:"required" xor:"a"`
+	}
+	_, err = NewParser(Config{}, &required)
+	assert.EqualError(t, err, ".File: positional and required fields cannot belong to groups")
+}
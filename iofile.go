@@ -0,0 +1,285 @@
+package arg
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// InputFile is a file that is opened for reading when the argument is parsed.
+// The name "-" means the standard input, and files whose names end in ".gz"
+// are decompressed as they are read. Use Parser.Close to close it.
+type InputFile struct {
+	// Name is the name of the file, after expanding "~" and resolving it
+	// against Config.BaseDir
+	Name string
+
+	state *fileState
+}
+
+// OutputFile is a file that is checked to be writable when the argument is
+// parsed, and created on the first write. The name "-" means the standard
+// output, and files whose names end in ".gz" are compressed as they are
+// written. Use Parser.Close to flush and close it.
+type OutputFile struct {
+	// Name is the name of the file, after expanding "~" and resolving it
+	// against Config.BaseDir
+	Name string
+
+	state *fileState
+}
+
+// fileState is shared between copies of an InputFile or OutputFile, so that
+// the parser can close a file however the value holding it was copied
+type fileState struct {
+	opened bool
+	r      io.Reader
+	w      io.Writer
+	stdout io.Writer // used for the output file "-"
+	closer io.Closer
+}
+
+// Close closes the file, if it was opened or created
+func (s *fileState) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	err := s.closer.Close()
+	s.closer = nil
+	return err
+}
+
+// fileIO holds what the parser provides to InputFile and OutputFile values
+type fileIO struct {
+	stdin   io.Reader
+	stdout  io.Writer
+	baseDir string
+	opened  []io.Closer // the files to close in Parser.Close
+}
+
+// fileOpener is implemented by the types that the parser opens once they have
+// been parsed
+type fileOpener interface {
+	open(files *fileIO) error
+}
+
+var fileOpenerType = reflect.TypeOf((*fileOpener)(nil)).Elem()
+
+// UnmarshalText records the name of the file to open
+func (f *InputFile) UnmarshalText(b []byte) error {
+	name, err := expandHome(string(b))
+	if err != nil {
+		return err
+	}
+	*f = InputFile{Name: name, state: &fileState{}}
+	return nil
+}
+
+// MarshalText returns the name of the file
+func (f InputFile) MarshalText() ([]byte, error) {
+	return []byte(f.Name), nil
+}
+
+// Read reads from the file, opening it first if the parser has not done so
+func (f *InputFile) Read(p []byte) (int, error) {
+	if f.state == nil || !f.state.opened {
+		if err := f.open(&fileIO{stdin: os.Stdin}); err != nil {
+			return 0, err
+		}
+	}
+	return f.state.r.Read(p)
+}
+
+// Close closes the file, unless it is the standard input
+func (f *InputFile) Close() error {
+	if f.state == nil {
+		return nil
+	}
+	return f.state.Close()
+}
+
+// open opens the file for reading, unless it is already open
+func (f *InputFile) open(files *fileIO) error {
+	if f.state == nil {
+		f.state = &fileState{}
+	}
+	if f.state.opened {
+		return nil
+	}
+	if f.Name == "" {
+		return errors.New("no input file was given")
+	}
+	if f.Name == "-" {
+		f.state.r = files.stdin
+		f.state.opened = true
+		return nil
+	}
+
+	f.Name = resolvePath(f.Name, files.baseDir)
+	file, err := os.Open(f.Name)
+	if err != nil {
+		return err
+	}
+	f.state.r, f.state.closer = file, file
+	if strings.HasSuffix(f.Name, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("error reading %s: %v", f.Name, err)
+		}
+		f.state.r, f.state.closer = gz, multiCloser{gz, file}
+	}
+	f.state.opened = true
+	files.opened = append(files.opened, f.state)
+	return nil
+}
+
+// UnmarshalText records the name of the file to create
+func (f *OutputFile) UnmarshalText(b []byte) error {
+	name, err := expandHome(string(b))
+	if err != nil {
+		return err
+	}
+	*f = OutputFile{Name: name, state: &fileState{}}
+	return nil
+}
+
+// MarshalText returns the name of the file
+func (f OutputFile) MarshalText() ([]byte, error) {
+	return []byte(f.Name), nil
+}
+
+// Write writes to the file, creating it on the first write
+func (f *OutputFile) Write(p []byte) (int, error) {
+	if f.state == nil {
+		f.state = &fileState{}
+	}
+	if f.state.w == nil {
+		if err := f.create(); err != nil {
+			return 0, err
+		}
+	}
+	return f.state.w.Write(p)
+}
+
+// Close flushes and closes the file, unless it is the standard output
+func (f *OutputFile) Close() error {
+	if f.state == nil {
+		return nil
+	}
+	return f.state.Close()
+}
+
+// open checks that the file can be written, unless it is the standard output
+func (f *OutputFile) open(files *fileIO) error {
+	if f.state == nil {
+		f.state = &fileState{}
+	}
+	if f.state.opened {
+		return nil
+	}
+	if f.Name != "-" {
+		f.Name = resolvePath(f.Name, files.baseDir)
+		if err := checkWritable(f.Name); err != nil {
+			return err
+		}
+	}
+	f.state.stdout = files.stdout
+	f.state.opened = true
+	files.opened = append(files.opened, f.state)
+	return nil
+}
+
+// create opens the file for writing
+func (f *OutputFile) create() error {
+	switch f.Name {
+	case "":
+		return errors.New("no output file was given")
+	case "-":
+		f.state.w = f.state.stdout
+		if f.state.w == nil {
+			f.state.w = os.Stdout
+		}
+		return nil
+	}
+
+	file, err := os.Create(f.Name)
+	if err != nil {
+		return err
+	}
+	f.state.w, f.state.closer = file, file
+	if strings.HasSuffix(f.Name, ".gz") {
+		gz := gzip.NewWriter(file)
+		f.state.w, f.state.closer = gz, multiCloser{gz, file}
+	}
+	return nil
+}
+
+// multiCloser closes each of its members in order, returning the first error
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var first error
+	for _, c := range m {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// isFileType returns true if the type, or the elements of a slice type, are
+// opened by the parser
+func isFileType(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Ptr {
+		t = reflect.PtrTo(t)
+	}
+	return t.Implements(fileOpenerType)
+}
+
+// openFiles opens each InputFile and OutputFile in v, which may also be a
+// pointer or a slice, that has not been opened yet
+func openFiles(v reflect.Value, files *fileIO) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := openFiles(v.Index(i), files); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if opener, ok := v.Addr().Interface().(fileOpener); ok {
+		return opener.open(files)
+	}
+	return nil
+}
+
+// Close closes the files opened for InputFile and OutputFile options, in the
+// reverse order to which they were opened, and returns the first error.
+// Execute calls Close once the commands have run.
+func (p *Parser) Close() error {
+	if p.files == nil {
+		return nil
+	}
+	var first error
+	for i := len(p.files.opened) - 1; i >= 0; i-- {
+		if err := p.files.opened[i].Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	p.files.opened = nil
+	return first
+}
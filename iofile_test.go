@@ -0,0 +1,223 @@
+package arg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipString(t *testing.T, s string) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.String()
+}
+
+func TestInputFile(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"in.txt":    "plain",
+		"in.txt.gz": gzipString(t, "compressed"),
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Plain      InputFile
+		Compressed InputFile
+	}
+	p, err := pparse("--plain "+filepath.Join(dir, "in.txt")+" --compressed "+filepath.Join(dir, "in.txt.gz"), &args)
+	require.NoError(t, err)
+	defer p.Close()
+
+	buf, err := ioutil.ReadAll(&args.Plain)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(buf))
+
+	buf, err = ioutil.ReadAll(&args.Compressed)
+	require.NoError(t, err)
+	assert.Equal(t, "compressed", string(buf))
+
+	assert.NoError(t, p.Close())
+}
+
+func TestInputFileErrors(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{"bad.gz": "not gzip"})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Input InputFile
+	}
+	missing := filepath.Join(dir, "missing.txt")
+	err := parse("--input "+missing, &args)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error processing --input: open "+missing)
+
+	bad := filepath.Join(dir, "bad.gz")
+	err = parse("--input "+bad, &args)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error processing --input: error reading "+bad)
+}
+
+func TestInputFileDefaultOverridden(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{"in.txt": "given", "default.txt": "default"})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		In InputFile `default:"/does/not/exist.txt"`
+	}
+	p, err := pparse("--in "+filepath.Join(dir, "in.txt"), &args)
+	require.NoError(t, err)
+	buf, err := ioutil.ReadAll(&args.In)
+	require.NoError(t, err)
+	assert.Equal(t, "given", string(buf))
+	require.NoError(t, p.Close())
+
+	// a default that is overridden is never opened
+	var other struct {
+		In InputFile `default:"default.txt"`
+	}
+	p, err = pparseconfig(Config{BaseDir: dir}, "--in in.txt", &other)
+	require.NoError(t, err)
+	assert.Len(t, p.files.opened, 1)
+	require.NoError(t, p.Close())
+}
+
+func TestInputFileStdin(t *testing.T) {
+	t.Parallel()
+	var args struct {
+		Inputs []InputFile `arg:"positional"`
+	}
+	config := Config{Stdin: strings.NewReader("from stdin")}
+	p, err := pparseconfig(config, "-", &args)
+	require.NoError(t, err)
+	require.Len(t, args.Inputs, 1)
+	assert.Equal(t, "-", args.Inputs[0].Name)
+
+	buf, err := ioutil.ReadAll(&args.Inputs[0])
+	require.NoError(t, err)
+	assert.Equal(t, "from stdin", string(buf))
+	assert.NoError(t, p.Close())
+}
+
+func TestOutputFile(t *testing.T) {
+	dir := writeTempFiles(t, nil)
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Plain      OutputFile
+		Compressed OutputFile
+		Unused     OutputFile
+	}
+	plain := filepath.Join(dir, "out.txt")
+	compressed := filepath.Join(dir, "out.txt.gz")
+	unused := filepath.Join(dir, "unused.txt")
+	p, err := pparse("--plain "+plain+" --compressed "+compressed+" --unused "+unused, &args)
+	require.NoError(t, err)
+
+	// files are only created when they are written
+	_, err = os.Stat(plain)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = args.Plain.Write([]byte("plain"))
+	require.NoError(t, err)
+	_, err = args.Compressed.Write([]byte("compressed"))
+	require.NoError(t, err)
+	require.NoError(t, p.Close())
+
+	buf, err := ioutil.ReadFile(plain)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(buf))
+
+	f, err := os.Open(compressed)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	buf, err = ioutil.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, "compressed", string(buf))
+
+	_, err = os.Stat(unused)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOutputFileNotWritable(t *testing.T) {
+	var args struct {
+		Output OutputFile
+	}
+	err := parse("--output /does/not/exist/out.txt", &args)
+	assert.EqualError(t, err, "error processing --output: directory /does/not/exist does not exist")
+}
+
+func TestOutputFileStdout(t *testing.T) {
+	t.Parallel()
+	var args struct {
+		Output OutputFile `default:"-"`
+	}
+	var stdout bytes.Buffer
+	p, err := pparseconfig(Config{Stdout: &stdout}, "", &args)
+	require.NoError(t, err)
+
+	_, err = args.Output.Write([]byte("to stdout"))
+	require.NoError(t, err)
+	require.NoError(t, p.Close())
+	assert.Equal(t, "to stdout", stdout.String())
+}
+
+func TestFilesBaseDir(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{"in.txt": "hello"})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Input  InputFile
+		Output OutputFile
+	}
+	p, err := pparseconfig(Config{BaseDir: dir}, "--input in.txt --output out.txt", &args)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "in.txt"), args.Input.Name)
+	assert.Equal(t, filepath.Join(dir, "out.txt"), args.Output.Name)
+	assert.NoError(t, p.Close())
+}
+
+type copyCmd struct {
+	Input  InputFile  `arg:"positional"`
+	Output OutputFile `arg:"positional"`
+}
+
+func (c *copyCmd) Run(ctx context.Context) error {
+	_, err := io.Copy(&c.Output, &c.Input)
+	return err
+}
+
+func TestExecuteClosesFiles(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{"in.txt": "copied"})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Copy *copyCmd `arg:"subcommand"`
+	}
+	out := filepath.Join(dir, "out.txt.gz")
+	p, err := pparse("copy "+filepath.Join(dir, "in.txt")+" "+out, &args)
+	require.NoError(t, err)
+	require.NoError(t, p.Execute(context.Background(), NormalStrategy))
+
+	// the compressed output is only complete once it has been closed
+	f, err := os.Open(out)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	buf, err := ioutil.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, "copied", string(buf))
+}
@@ -4,10 +4,14 @@ import (
 	"encoding/csv"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
 
 	scalar "github.com/alexflint/go-scalar"
 )
@@ -54,6 +58,25 @@ type spec struct {
 	help       string
 	env        string
 	boolean    bool
+	negatable  bool           // whether --no-foo is accepted to set the option to false
+	counter    bool           // whether each occurrence increments an integer
+	optional   bool           // whether the value may be omitted, as in --color[=WHEN]
+	bareValue  string         // the value used when an optional value is omitted
+	nargs      int            // number of values taken by each occurrence, or zero for any number
+	remainder  bool           // whether a passthrough field stops parsing at the first unknown argument
+	configFile bool           // whether this option names a config file to load values from
+	noEnv      bool           // whether the option is exempt from Config.EnvPrefix
+	defaultVal string         // the value from the default tag, if any
+	secret     bool           // whether the value must be hidden and can be read from a file
+	choices    []string       // the values that are allowed, if limited
+	group      *group         // the group that the option belongs to, if any
+	min        reflect.Value  // the lower bound from the min tag, if valid
+	max        reflect.Value  // the upper bound from the max tag, if valid
+	pattern    *regexp.Regexp // the pattern that values must match, if any
+	patternMsg string         // describes the pattern in error messages
+	isPath     bool           // whether values are paths to resolve against baseDir
+	baseDir    string         // the directory that relative paths are relative to
+	files      *fileIO        // opens InputFile and OutputFile values, if not nil
 }
 
 // command represents a named subcommand, or the top-level command
@@ -64,6 +87,8 @@ type command struct {
 	specs       []*spec
 	subcommands []*command
 	parent      *command
+	passthrough *spec    // collects arguments that are not recognised, if not nil
+	groups      []*group // options that must be given alone or together
 }
 
 // ErrHelp indicates that -h or --help were provided
@@ -81,19 +106,24 @@ func MustParse(dest ...interface{}) *Parser {
 		return nil // just in case osExit was monkey-patched
 	}
 
-	err = p.Parse(flags())
+	p.MustParse(flags())
+	return p
+}
+
+// MustParse processes the given command line arguments and exits upon
+// failure, writing help and errors to the writers given in the Config
+func (p *Parser) MustParse(args []string) {
+	err := p.Parse(args)
 	switch {
 	case err == ErrHelp:
-		p.writeHelpForCommand(os.Stdout, p.lastCmd)
-		osExit(0)
+		p.writeHelpForCommand(p.stdout(), p.lastCmd)
+		p.exit(0)
 	case err == ErrVersion:
-		fmt.Println(p.version)
-		osExit(0)
+		fmt.Fprintln(p.stdout(), p.version)
+		p.exit(0)
 	case err != nil:
 		p.failWithCommand(err.Error(), p.lastCmd)
 	}
-
-	return p
 }
 
 // Parse processes command line arguments and stores them in dest
@@ -117,6 +147,58 @@ func flags() []string {
 type Config struct {
 	// Program is the name of the program used in the help text
 	Program string
+
+	// AllowAbbreviations enables unambiguous prefixes of long options and
+	// subcommands, so that "--verb" resolves to "--verbose" and "chec" to
+	// "checkout". Exact matches always take precedence over abbreviations.
+	AllowAbbreviations bool
+
+	// ResponseFiles enables the expansion of arguments of the form "@path" into
+	// the arguments read from that file. Use "@@" to pass a literal argument
+	// that starts with "@".
+	ResponseFiles bool
+
+	// Sources are consulted in order for the values of options, before the
+	// command line is processed. The first source that has a value for an
+	// option wins, and values on the command line override them all. If
+	// Sources is nil then only environment variables are consulted.
+	Sources []ValueSource
+
+	// EnvPrefix binds every option that has no environment variable to one
+	// named PREFIX_SUBCOMMAND_FIELD_NAME, where the subcommand and field names
+	// are converted to upper snake case. Options tagged with "noenv" are not
+	// bound.
+	EnvPrefix string
+
+	// LookupEnv looks up environment variables. If nil, os.LookupEnv is used.
+	LookupEnv func(key string) (string, bool)
+
+	// Stdout receives the help and version text written by MustParse, and
+	// whatever is written to OutputFile options given as "-". If nil,
+	// os.Stdout is used.
+	Stdout io.Writer
+
+	// Stderr receives the usage and error messages written by MustParse and
+	// Fail. If nil, os.Stderr is used.
+	Stderr io.Writer
+
+	// Exit is called by MustParse and Fail to end the program. If nil, os.Exit
+	// is used.
+	Exit func(code int)
+
+	// DotEnvFiles are dotenv files to read environment variables from, in the
+	// format described for LoadDotEnv. The real environment takes precedence
+	// over these files, and missing files are skipped.
+	DotEnvFiles []string
+
+	// BaseDir is the directory that relative paths given for options of type
+	// ExistingFile, ExistingDir, NewFile, InputFile and OutputFile are
+	// relative to. If empty, they are relative to the working directory.
+	BaseDir string
+
+	// Stdin is read by InputFile options given as "-". If nil, os.Stdin is
+	// used.
+	Stdin io.Reader
 }
 
 // Parser represents a set of command line options with destination values
@@ -131,9 +213,12 @@ type Parser struct {
 	// the following fields change during processing of command line arguments
 	lastCmd  *command
 	execTree []interface{}
+	files    *fileIO // the files opened for InputFile and OutputFile options
 
 	// processing state
 	wasPresent map[*spec]bool
+	origins    map[*spec]*Provenance
+	dotenv     map[string]string // variables read from Config.DotEnvFiles
 	specs      []*spec
 	curCmd     *command
 }
@@ -154,6 +239,15 @@ type Described interface {
 	Description() string
 }
 
+// Validatable is the interface that the destination struct and subcommand
+// structs can implement to check their values once all arguments have been
+// processed.
+type Validatable interface {
+	// Validate returns an error if the values in the struct are not valid.
+	// It is called on the innermost subcommand first and the root last.
+	Validate() error
+}
+
 // walkFields calls a function for each field of a struct, recursively expanding struct fields.
 func walkFields(t reflect.Type, visit func(field reflect.StructField, owner reflect.Type) bool) {
 	for i := 0; i < t.NumField(); i++ {
@@ -186,6 +280,16 @@ func NewParser(config Config, dests ...interface{}) (*Parser, error) {
 		curCmd: cmd,
 	}
 
+	// InputFile and OutputFile options are opened through the parser
+	p.files = &fileIO{
+		stdin:   config.Stdin,
+		stdout:  p.stdout(),
+		baseDir: config.BaseDir,
+	}
+	if p.files.stdin == nil {
+		p.files.stdin = os.Stdin
+	}
+
 	if err := p.AddDestinations(dests...); err != nil {
 		return nil, err
 	}
@@ -215,6 +319,26 @@ func (p *Parser) AddDestinations(dests ...interface{}) error {
 
 		p.curCmd.specs = append(p.curCmd.specs, cmd.specs...)
 		p.curCmd.subcommands = append(p.curCmd.subcommands, cmd.subcommands...)
+		for _, subcmd := range cmd.subcommands {
+			// the subcommands now belong to the current command rather than
+			// the one built for this destination
+			subcmd.parent = p.curCmd
+		}
+		p.curCmd.groups = append(p.curCmd.groups, cmd.groups...)
+		if cmd.passthrough != nil {
+			p.curCmd.passthrough = cmd.passthrough
+		}
+
+		setFileOptions(cmd, p.files)
+
+		if p.config.EnvPrefix != "" {
+			// include the names of the subcommands leading to the current one
+			var names []string
+			for cur := p.curCmd; cur.parent != nil; cur = cur.parent {
+				names = append([]string{toUpperSnake(cur.name)}, names...)
+			}
+			bindEnvPrefix(cmd, strings.Join(append([]string{p.config.EnvPrefix}, names...), "_"))
+		}
 
 		if dest, ok := dest.(Versioned); ok {
 			p.version = dest.Version()
@@ -270,8 +394,20 @@ func cmdFromStruct(name string, dest path, t reflect.Type) (*command, error) {
 			spec.help = help
 		}
 
+		defaultVal, hasDefault := field.Tag.Lookup("default")
+		if hasDefault {
+			spec.defaultVal = defaultVal
+		}
+
+		choices, hasChoices := field.Tag.Lookup("choices")
+		if hasChoices {
+			spec.choices = parseChoices(choices)
+		}
+
 		var isSubcommand bool
 		var cmdname string
+		var noNegate bool
+		var isPassthrough bool
 
 		// check for subcommand by interface mplementation first
 		if isRunner(field.Type) {
@@ -307,6 +443,28 @@ func cmdFromStruct(name string, dest path, t reflect.Type) (*command, error) {
 					spec.positional = true
 				case key == "separate":
 					spec.separate = true
+				case key == "nonegate":
+					noNegate = true
+				case key == "counter":
+					spec.counter = true
+				case key == "nargs":
+					n, err := strconv.Atoi(value)
+					if err != nil || n < 1 {
+						errs = append(errs, fmt.Sprintf("%s.%s: nargs must be a positive integer",
+							t.Name(), field.Name))
+						return false
+					}
+					spec.nargs = n
+				case key == "config":
+					spec.configFile = true
+				case key == "passthrough":
+					isPassthrough = true
+				case key == "remainder":
+					isPassthrough = true
+					spec.remainder = true
+				case key == "optional":
+					spec.optional = true
+					spec.bareValue = value
 				case key == "help": // deprecated
 					spec.help = value
 				case key == "env":
@@ -316,6 +474,10 @@ func cmdFromStruct(name string, dest path, t reflect.Type) (*command, error) {
 					} else {
 						spec.env = strings.ToUpper(field.Name)
 					}
+				case key == "noenv":
+					spec.noEnv = true
+				case key == "secret":
+					spec.secret = true
 				case key == "subcommand":
 					if value != "" {
 						cmdname = value
@@ -335,7 +497,20 @@ func cmdFromStruct(name string, dest path, t reflect.Type) (*command, error) {
 		// wait until ParseValue because it means that a program with invalid argument
 		// fields will always fail regardless of whether the arguments it received
 		// exercised those fields.
-		if !isSubcommand {
+		if isPassthrough {
+			if field.Type.Kind() != reflect.Slice || field.Type.Elem().Kind() != reflect.String {
+				errs = append(errs, fmt.Sprintf("%s.%s: passthrough fields must be string slices",
+					t.Name(), field.Name))
+				return false
+			}
+			if cmd.passthrough != nil {
+				errs = append(errs, fmt.Sprintf("%s.%s: only one passthrough field is allowed per command",
+					t.Name(), field.Name))
+				return false
+			}
+			spec.multiple = true
+			cmd.passthrough = &spec
+		} else if !isSubcommand {
 			cmd.specs = append(cmd.specs, &spec)
 
 			var parseable bool
@@ -345,6 +520,140 @@ func cmdFromStruct(name string, dest path, t reflect.Type) (*command, error) {
 					t.Name(), field.Name, field.Type.String()))
 				return false
 			}
+
+			if spec.counter && !isInteger(field.Type) {
+				errs = append(errs, fmt.Sprintf("%s.%s: counter fields must be integers",
+					t.Name(), field.Name))
+				return false
+			}
+
+			if !hasChoices {
+				spec.choices = choicesOf(field.Type)
+			}
+			if hasChoices && len(spec.choices) == 0 {
+				errs = append(errs, fmt.Sprintf("%s.%s: choices must not be empty",
+					t.Name(), field.Name))
+				return false
+			}
+			if len(spec.choices) > 0 && field.Type.Kind() == reflect.Map {
+				errs = append(errs, fmt.Sprintf("%s.%s: choices are not supported for maps",
+					t.Name(), field.Name))
+				return false
+			}
+
+			for _, bound := range []struct {
+				tag  string
+				dest *reflect.Value
+			}{{"min", &spec.min}, {"max", &spec.max}} {
+				value, ok := field.Tag.Lookup(bound.tag)
+				if !ok {
+					continue
+				}
+				if field.Type.Kind() == reflect.Map {
+					errs = append(errs, fmt.Sprintf("%s.%s: min and max are not supported for maps",
+						t.Name(), field.Name))
+					return false
+				}
+				v, err := parseBound(field.Type, value)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s.%s: invalid %s value %q: %v",
+						t.Name(), field.Name, bound.tag, value, err))
+					return false
+				}
+				*bound.dest = v
+			}
+			if spec.min.IsValid() && spec.max.IsValid() && lessValue(spec.max, spec.min) {
+				errs = append(errs, fmt.Sprintf("%s.%s: min is greater than max",
+					t.Name(), field.Name))
+				return false
+			}
+
+			if pattern, ok := field.Tag.Lookup("pattern"); ok {
+				re, err := compilePattern(field.Type, pattern)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s.%s: invalid pattern %q: %v",
+						t.Name(), field.Name, pattern, err))
+					return false
+				}
+				spec.pattern = re
+				spec.patternMsg = field.Tag.Get("patternhelp")
+			}
+
+			if spec.secret && spec.multiple {
+				errs = append(errs, fmt.Sprintf("%s.%s: secret fields cannot have multiple values",
+					t.Name(), field.Name))
+				return false
+			}
+
+			spec.isPath = isPathType(field.Type)
+
+			if hasDefault {
+				if spec.required {
+					errs = append(errs, fmt.Sprintf("%s.%s: required fields cannot have a default value",
+						t.Name(), field.Name))
+					return false
+				}
+				// paths and files are only checked when the default is applied,
+				// once they can be resolved against the base directory
+				if !spec.isPath && !isFileType(field.Type) {
+					if err := setDefault(reflect.New(field.Type).Elem(), &spec); err != nil {
+						shown := spec.defaultVal
+						if spec.secret {
+							shown = secretMask
+						}
+						errs = append(errs, fmt.Sprintf("%s.%s: invalid default value %q: %v",
+							t.Name(), field.Name, shown, err))
+						return false
+					}
+				}
+			}
+
+			if spec.configFile && field.Type.Kind() != reflect.String {
+				errs = append(errs, fmt.Sprintf("%s.%s: config fields must be strings",
+					t.Name(), field.Name))
+				return false
+			}
+
+			if spec.nargs > 0 && (!spec.multiple || spec.positional) {
+				errs = append(errs, fmt.Sprintf("%s.%s: nargs is only supported for options with multiple values",
+					t.Name(), field.Name))
+				return false
+			}
+
+			if spec.optional {
+				if spec.boolean || spec.multiple || spec.counter || spec.positional {
+					errs = append(errs, fmt.Sprintf("%s.%s: optional values are only supported for options with a single value",
+						t.Name(), field.Name))
+					return false
+				}
+				if err := setValue(reflect.New(field.Type).Elem(), &spec, spec.bareValue); err != nil {
+					errs = append(errs, fmt.Sprintf("%s.%s: invalid optional value %q: %v",
+						t.Name(), field.Name, spec.bareValue, err))
+					return false
+				}
+			}
+
+			// boolean options can be switched off with --no-foo unless told otherwise
+			spec.negatable = spec.boolean && !spec.multiple && !spec.positional && !noNegate
+
+			// put the option in a group if it has one of the group tags
+			for _, kind := range groupKinds {
+				name, ok := field.Tag.Lookup(kind)
+				if !ok {
+					continue
+				}
+				switch {
+				case spec.group != nil:
+					errs = append(errs, fmt.Sprintf("%s.%s: options can only belong to one group",
+						t.Name(), field.Name))
+					return false
+				case spec.positional || spec.required:
+					errs = append(errs, fmt.Sprintf("%s.%s: positional and required fields cannot belong to groups",
+						t.Name(), field.Name))
+					return false
+				}
+				cmd.addToGroup(kind, name, &spec)
+			}
 		} else {
 			// parse the subcommand recursively
 			subcmd, err := cmdFromStruct(cmdname, subdest, field.Type)
@@ -381,13 +690,87 @@ func cmdFromStruct(name string, dest path, t reflect.Type) (*command, error) {
 	return &cmd, nil
 }
 
+// setFileOptions sets the directory that relative paths are resolved against
+// for each option of the command and its subcommands, and how options of type
+// InputFile and OutputFile are opened
+func setFileOptions(cmd *command, files *fileIO) {
+	for _, spec := range cmd.specs {
+		spec.baseDir = files.baseDir
+		if isFileType(spec.typ) {
+			spec.files = files
+		}
+	}
+	for _, subcmd := range cmd.subcommands {
+		setFileOptions(subcmd, files)
+	}
+}
+
+// bindEnvPrefix binds each option of the command and its subcommands that has
+// no environment variable to one named after the prefix and the field
+func bindEnvPrefix(cmd *command, prefix string) {
+	for _, spec := range cmd.specs {
+		if spec.env != "" || spec.noEnv || spec.positional {
+			continue
+		}
+		field := spec.dest.fields[len(spec.dest.fields)-1]
+		spec.env = prefix + "_" + toUpperSnake(field)
+	}
+	for _, subcmd := range cmd.subcommands {
+		bindEnvPrefix(subcmd, prefix+"_"+toUpperSnake(subcmd.name))
+	}
+}
+
+// toUpperSnake converts a name such as "MaxRetries", "HTTPPort" or "dry-run" to
+// upper snake case, as in "MAX_RETRIES", "HTTP_PORT" or "DRY_RUN"
+func toUpperSnake(s string) string {
+	runes := []rune(s)
+	var out []rune
+	for i, r := range runes {
+		if r == '-' || r == '_' || r == ' ' {
+			if len(out) > 0 && out[len(out)-1] != '_' {
+				out = append(out, '_')
+			}
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) && len(out) > 0 && out[len(out)-1] != '_' {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				out = append(out, '_')
+			}
+		}
+		out = append(out, unicode.ToUpper(r))
+	}
+	return string(out)
+}
+
 // Parse processes the given command line option, storing the results in the field
 // of the structs from which NewParser was constructed
 func (p *Parser) Parse(args []string) error {
 	// check if this is the root parser
 	if p.specs == nil {
+		// replace any response files with their contents
+		if p.config.ResponseFiles {
+			var err error
+			args, err = expandResponseFiles(args)
+			if err != nil {
+				return err
+			}
+		}
+
+		// read dotenv files before anything looks up environment variables
+		p.dotenv = nil
+		if len(p.config.DotEnvFiles) > 0 {
+			dotenv, err := loadDotEnv(p.config.DotEnvFiles, p.lookupEnv, true)
+			if err != nil {
+				return err
+			}
+			p.dotenv = dotenv
+		}
+
 		// track the options we have seen
 		p.wasPresent = make(map[*spec]bool)
+		p.origins = make(map[*spec]*Provenance)
 
 		// union of specs for the chain of subcommands encountered so far
 		p.curCmd = p.cmd
@@ -397,14 +780,25 @@ func (p *Parser) Parse(args []string) error {
 		p.specs = make([]*spec, len(p.cmd.specs))
 		copy(p.specs, p.cmd.specs)
 
+		// assign values from default tags
+		err := p.setDefaults(p.specs)
+		if err != nil {
+			return err
+		}
+
 		// deal with environment vars
-		err := p.captureEnvVars(p.specs, p.wasPresent)
+		err = p.captureEnvVars(p.specs, p.wasPresent)
 		if err != nil {
 			return err
 		}
 		// process
 		err = p.process(args)
 
+		// check the structs that were filled in
+		if err == nil {
+			err = p.validate()
+		}
+
 		// clear specs to mark root parser
 		p.specs = nil
 
@@ -414,8 +808,14 @@ func (p *Parser) Parse(args []string) error {
 	// any new specs to the p.specs slice
 	p.specs = appendUniqSpecs(p.specs, p.curCmd.specs)
 
+	// assign values from default tags for the new specs
+	err := p.setDefaults(p.curCmd.specs)
+	if err != nil {
+		return err
+	}
+
 	// handle environment vars for the new specs
-	err := p.captureEnvVars(p.specs, p.wasPresent)
+	err = p.captureEnvVars(p.specs, p.wasPresent)
 	if err != nil {
 		return err
 	}
@@ -423,14 +823,130 @@ func (p *Parser) Parse(args []string) error {
 	return p.process(args)
 }
 
-// process environment vars for the given arguments
+// setDefaults assigns the values from default tags to the given options,
+// except for those that have already been given a value and those whose
+// defaults are deferred until the arguments have been processed
+func (p *Parser) setDefaults(specs []*spec) error {
+	for _, spec := range specs {
+		if spec.defaultVal == "" || p.wasPresent[spec] || deferDefault(spec) {
+			continue
+		}
+		if err := p.applyDefault(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDeferredDefaults assigns the deferred defaults of the options that were
+// not given a value by the command line, the environment or a config file
+func (p *Parser) setDeferredDefaults() error {
+	for _, spec := range p.specs {
+		if spec.defaultVal == "" || p.wasPresent[spec] || !deferDefault(spec) {
+			continue
+		}
+		if err := p.applyDefault(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deferDefault returns true if the default of an option is only assigned once
+// nothing else has given it a value, because assigning it checks the
+// filesystem or opens a file
+func deferDefault(spec *spec) bool {
+	return spec.isPath || spec.files != nil
+}
+
+// holdsDefault returns true if an option still holds the value from its
+// default tag
+func (p *Parser) holdsDefault(spec *spec) bool {
+	rec, ok := p.origins[spec]
+	return ok && rec.Origin == OriginDefault
+}
+
+// applyDefault assigns the value from the default tag of an option
+func (p *Parser) applyDefault(spec *spec) error {
+	if err := setDefault(p.val(spec.dest), spec); err != nil {
+		return fmt.Errorf("error processing default value for %s: %v", spec.long, err)
+	}
+	p.record(spec, OriginDefault, "default", []string{spec.defaultVal}, true)
+	return nil
+}
+
+// setDefault parses the value from the default tag of an option into dest.
+// Options with multiple values take a CSV string, as in environment variables.
+func setDefault(dest reflect.Value, spec *spec) error {
+	if !spec.multiple {
+		return setValue(dest, spec, spec.defaultVal)
+	}
+	values, err := csv.NewReader(strings.NewReader(spec.defaultVal)).Read()
+	if err != nil {
+		return err
+	}
+	return setValues(dest, spec, values, true)
+}
+
+// process environment vars and other value sources for the given arguments
 func (p *Parser) captureEnvVars(specs []*spec, wasPresent map[*spec]bool) error {
+	sources := p.config.Sources
+	if sources == nil {
+		sources = []ValueSource{EnvSource{}}
+	}
+
 	for _, spec := range specs {
-		if spec.env == "" {
+		// options already given on the command line take precedence
+		if wasPresent[spec] {
 			continue
 		}
 
-		value, found := os.LookupEnv(spec.env)
+		ref := OptionRef{
+			Path: spec.dest.String(),
+			Long: spec.long,
+			Env:  spec.env,
+		}
+
+		// the first source that has a value for the option wins
+		var value, from string
+		var found bool
+		origin := OriginSource
+		for _, src := range sources {
+			// look up environment variables through the parser unless the
+			// source was given its own lookup function
+			if env, ok := src.(EnvSource); ok && env.LookupEnv == nil {
+				src = EnvSource{LookupEnv: p.lookupEnv}
+			}
+
+			var err error
+			value, found, err = src.Lookup(ref)
+			if err != nil {
+				return fmt.Errorf("error looking up %s: %v", describeSource(src, ref), err)
+			}
+			if found {
+				from = describeSource(src, ref)
+				if _, ok := src.(EnvSource); ok {
+					origin = OriginEnv
+				}
+				break
+			}
+		}
+
+		// a secret can also be read from the file named by an environment
+		// variable such as DB_PASSWORD_FILE
+		if !found && spec.secret && spec.env != "" {
+			fileEnv := spec.env + "_FILE"
+			if name, ok := p.lookupEnv(fileEnv); ok {
+				var err error
+				value, err = readSecretFile(name)
+				if err != nil {
+					return fmt.Errorf("error processing environment variable %s: %v", fileEnv, err)
+				}
+				found = true
+				from = "environment variable " + fileEnv
+				origin = OriginEnv
+			}
+		}
 		if !found {
 			continue
 		}
@@ -441,24 +957,33 @@ func (p *Parser) captureEnvVars(specs []*spec, wasPresent map[*spec]bool) error
 			values, err := csv.NewReader(strings.NewReader(value)).Read()
 			if err != nil {
 				return fmt.Errorf(
-					"error reading a CSV string from environment variable %s with multiple values: %v",
-					spec.env,
+					"error reading a CSV string from %s with multiple values: %v",
+					from,
 					err,
 				)
 			}
-			if err = setSlice(p.val(spec.dest), values, !spec.separate); err != nil {
+			if spec.nargs > 0 && len(values)%spec.nargs != 0 {
+				return fmt.Errorf(
+					"error processing %s: expected a multiple of %d values but got %d",
+					from,
+					spec.nargs,
+					len(values),
+				)
+			}
+			if err = setValues(p.val(spec.dest), spec, values, !spec.separate || p.holdsDefault(spec)); err != nil {
 				return fmt.Errorf(
-					"error processing environment variable %s with multiple values: %v",
-					spec.env,
+					"error processing %s with multiple values: %v",
+					from,
 					err,
 				)
 			}
 		} else {
-			if err := scalar.ParseValue(p.val(spec.dest), value); err != nil {
-				return fmt.Errorf("error processing environment variable %s: %v", spec.env, err)
+			if err := setValue(p.val(spec.dest), spec, value); err != nil {
+				return fmt.Errorf("error processing %s: %v", from, err)
 			}
 		}
 		wasPresent[spec] = true
+		p.record(spec, origin, from, []string{value}, true)
 	}
 
 	return nil
@@ -472,10 +997,20 @@ func (p *Parser) process(args []string) error {
 	var allpositional bool
 	var positionals []string
 
+	// options whose values accumulate across occurrences that have been seen so far
+	seen := make(map[*spec]bool)
+
 	// must use explicit for loop, not range, because we manipulate i inside the loop
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 		if arg == "--" {
+			// with a passthrough field everything after "--" is passed through
+			if pt := p.passthrough(); pt != nil {
+				if err := p.appendPassthrough(pt, args[i+1:], seen); err != nil {
+					return err
+				}
+				break
+			}
 			allpositional = true
 			continue
 		}
@@ -483,13 +1018,34 @@ func (p *Parser) process(args []string) error {
 		if !isFlag(arg) || allpositional {
 			// each subcommand can have either subcommands or positionals, but not both
 			if len(p.curCmd.subcommands) == 0 {
+				// in remainder mode a positional that no field can hold stops parsing
+				capacity := positionalCapacity(p.specs)
+				if pt := p.passthrough(); pt != nil && pt.remainder && capacity >= 0 && len(positionals) >= capacity {
+					if err := p.appendPassthrough(pt, args[i:], seen); err != nil {
+						return err
+					}
+					break
+				}
 				positionals = append(positionals, arg)
 				continue
 			}
 
 			// if we have a subcommand then make sure it is valid for the current context
 			subcmd := findSubcommand(p.curCmd.subcommands, arg)
+			if subcmd == nil && p.config.AllowAbbreviations {
+				var err error
+				subcmd, err = findSubcommandByPrefix(p.curCmd.subcommands, arg)
+				if err != nil {
+					return err
+				}
+			}
 			if subcmd == nil {
+				if pt := p.passthrough(); pt != nil && pt.remainder {
+					if err := p.appendPassthrough(pt, args[i:], seen); err != nil {
+						return err
+					}
+					break
+				}
 				return fmt.Errorf("invalid subcommand: %s", arg)
 			}
 
@@ -498,6 +1054,11 @@ func (p *Parser) process(args []string) error {
 			ptr := reflect.New(v.Type().Elem())
 			v.Set(ptr) // we already checked that all subcommands are struct pointers
 
+			// assign values from default tags now that the struct exists
+			if err := p.setDefaults(subcmd.specs); err != nil {
+				return err
+			}
+
 			// put it in the execution tree
 			if isRunner(v.Type()) {
 				p.execTree = append(p.execTree, v.Interface())
@@ -534,21 +1095,128 @@ func (p *Parser) process(args []string) error {
 
 		// check for an equals sign, as in "--foo=bar"
 		var value string
+		var hasValue bool
 		opt := strings.TrimLeft(arg, "-")
 		if pos := strings.Index(opt, "="); pos != -1 {
 			value = opt[pos+1:]
 			opt = opt[:pos]
+			hasValue = true
 		}
 
 		// lookup the spec for this option (note that the "specs" slice changes as
 		// we expand subcommands so it is better not to use a map)
 		spec := findOption(p.specs, opt)
+		var negated, fromFile bool
 		if spec == nil {
-			return fmt.Errorf("unknown argument %s", arg)
+			spec = findNegatedOption(p.specs, opt)
+			negated = spec != nil
+		}
+		if spec == nil {
+			spec = findSecretFileOption(p.specs, opt)
+			fromFile = spec != nil
+		}
+		if spec == nil && p.config.AllowAbbreviations && strings.HasPrefix(arg, "--") {
+			var err error
+			spec, negated, err = findOptionByPrefix(p.specs, opt)
+			if err != nil {
+				return err
+			}
+		}
+		if spec == nil {
+			// try to interpret something like "-abc" or "-ofile" as a cluster of short options
+			if expanded := expandShortFlags(p.specs, arg); expanded != nil {
+				// splice the expanded tokens in place of the original one and reprocess
+				args = append(append(append([]string{}, args[:i]...), expanded...), args[i+1:]...)
+				i--
+				continue
+			}
+
+			pt := p.passthrough()
+			if pt == nil {
+				return fmt.Errorf("unknown argument %s", arg)
+			}
+			if pt.remainder {
+				if err := p.appendPassthrough(pt, args[i:], seen); err != nil {
+					return err
+				}
+				break
+			}
+
+			// pass the option through, together with the next argument if that
+			// looks like its value and nothing else would accept it
+			unknown := []string{arg}
+			if !hasValue && i+1 < len(args) && !isFlag(args[i+1]) && args[i+1] != "--" &&
+				positionalCapacity(p.specs) == 0 && findSubcommand(p.curCmd.subcommands, args[i+1]) == nil {
+				unknown = append(unknown, args[i+1])
+				i++
+			}
+			if err := p.appendPassthrough(pt, unknown, seen); err != nil {
+				return err
+			}
+			continue
 		}
 		p.wasPresent[spec] = true
+		from := strings.SplitN(arg, "=", 2)[0]
+
+		// the value of a secret given as "--password=x" is left out of errors
+		shown := arg
+		if spec.secret {
+			shown = from
+		}
+
+		// something like "--password-file PATH" reads a secret from a file
+		if fromFile {
+			if !hasValue {
+				if i+1 == len(args) || isFlag(args[i+1]) {
+					return fmt.Errorf("missing value for %s", arg)
+				}
+				value = args[i+1]
+				i++
+			}
+			secret, err := readSecretFile(value)
+			if err != nil {
+				return fmt.Errorf("error processing %s: %v", arg, err)
+			}
+			if err := setValue(p.val(spec.dest), spec, secret); err != nil {
+				return fmt.Errorf("error processing %s: %v", arg, err)
+			}
+			p.record(spec, OriginCommandLine, from, []string{secret}, true)
+			continue
+		}
+
+		// something like "--no-foo" sets a boolean option to false
+		if negated {
+			if value != "" {
+				return fmt.Errorf("%s does not take a value", arg)
+			}
+			value = "false"
+		}
 
 		// deal with the case of multiple values
+		if spec.multiple && spec.nargs > 0 {
+			var values []string
+			if hasValue {
+				values = append(values, value)
+			}
+			for len(values) < spec.nargs && i+1 < len(args) {
+				if isFlag(args[i+1]) && !nextIsNumeric(spec.typ.Elem(), args[i+1]) {
+					break
+				}
+				values = append(values, args[i+1])
+				i++
+			}
+			if len(values) < spec.nargs {
+				return fmt.Errorf("%s requires %d values but got %d", arg, spec.nargs, len(values))
+			}
+			// the first occurrence replaces any default values, later ones append
+			err := setValues(p.val(spec.dest), spec, values, !seen[spec])
+			if err != nil {
+				return fmt.Errorf("error processing %s: %v", arg, err)
+			}
+			p.record(spec, OriginCommandLine, from, values, !seen[spec])
+			seen[spec] = true
+			continue
+		}
 		if spec.multiple {
 			var values []string
 			if value == "" {
@@ -562,10 +1230,41 @@ func (p *Parser) process(args []string) error {
 			} else {
 				values = append(values, value)
 			}
-			err := setSlice(p.val(spec.dest), values, !spec.separate)
+			// maps accumulate pairs across occurrences, as in "--label a=1 --label b=2",
+			// and separate options accumulate values but replace a tag default
+			trunc := !spec.separate || p.holdsDefault(spec)
+			if spec.typ.Kind() == reflect.Map {
+				trunc = !seen[spec]
+				seen[spec] = true
+			}
+			err := setValues(p.val(spec.dest), spec, values, trunc)
 			if err != nil {
 				return fmt.Errorf("error processing %s: %v", arg, err)
 			}
+			p.record(spec, OriginCommandLine, from, values, trunc)
+			continue
+		}
+
+		// if it's a counter and it has no value then increment it
+		if spec.counter && value == "" {
+			increment(p.val(spec.dest))
+			if err := checkRange(spec, p.val(spec.dest)); err != nil {
+				return fmt.Errorf("error processing %s: %v", arg, err)
+			}
+			p.record(spec, OriginCommandLine, from, []string{arg}, false)
+			continue
+		}
+
+		// an optional value can only be given with an equals sign, as in
+		// "--color=always", otherwise the bare value is used
+		if spec.optional {
+			if !hasValue {
+				value = spec.bareValue
+			}
+			if err := setValue(p.val(spec.dest), spec, value); err != nil {
+				return fmt.Errorf("error processing %s: %v", shown, err)
+			}
+			p.record(spec, OriginCommandLine, from, []string{value}, true)
 			continue
 		}
 
@@ -587,32 +1286,50 @@ func (p *Parser) process(args []string) error {
 			i++
 		}
 
-		err := scalar.ParseValue(p.val(spec.dest), value)
+		err := setValue(p.val(spec.dest), spec, value)
 		if err != nil {
-			return fmt.Errorf("error processing %s: %v", arg, err)
+			return fmt.Errorf("error processing %s: %v", shown, err)
 		}
+		p.record(spec, OriginCommandLine, from, []string{value}, true)
 	}
 
 	// process positionals
+	var posSpecs []*spec
 	for _, spec := range p.specs {
-		if !spec.positional {
-			continue
+		if spec.positional {
+			posSpecs = append(posSpecs, spec)
 		}
+	}
+	for i, spec := range posSpecs {
 		if len(positionals) == 0 {
 			break
 		}
-		p.wasPresent[spec] = true
 		if spec.multiple {
-			err := setSlice(p.val(spec.dest), positionals, true)
+			// leave one value for each single positional that comes after this
+			// one so that something like "cp SOURCES... DEST" works
+			n := len(positionals)
+			for _, later := range posSpecs[i+1:] {
+				if !later.multiple {
+					n--
+				}
+			}
+			if n <= 0 {
+				continue
+			}
+			p.wasPresent[spec] = true
+			err := setValues(p.val(spec.dest), spec, positionals[:n], true)
 			if err != nil {
 				return fmt.Errorf("error processing %s: %v", spec.long, err)
 			}
-			positionals = nil
+			p.record(spec, OriginCommandLine, strings.ToUpper(spec.long), positionals[:n], true)
+			positionals = positionals[n:]
 		} else {
-			err := scalar.ParseValue(p.val(spec.dest), positionals[0])
+			p.wasPresent[spec] = true
+			err := setValue(p.val(spec.dest), spec, positionals[0])
 			if err != nil {
 				return fmt.Errorf("error processing %s: %v", spec.long, err)
 			}
+			p.record(spec, OriginCommandLine, strings.ToUpper(spec.long), positionals[:1], true)
 			positionals = positionals[1:]
 		}
 	}
@@ -620,6 +1337,17 @@ func (p *Parser) process(args []string) error {
 		return fmt.Errorf("too many positional arguments at '%s'", positionals[0])
 	}
 
+	// fill in anything not given on the command line or in the environment
+	// from the config file
+	if err := p.applyConfigFile(); err != nil {
+		return err
+	}
+
+	// and only then from the defaults that check or open files
+	if err := p.setDeferredDefaults(); err != nil {
+		return err
+	}
+
 	// finally check that all the required args were provided
 	for _, spec := range p.specs {
 		if spec.required && !p.wasPresent[spec] {
@@ -631,9 +1359,51 @@ func (p *Parser) process(args []string) error {
 		}
 	}
 
+	// and that the options in each group were given alone or together as required
+	return p.checkGroups()
+}
+
+// passthrough returns the field that collects arguments not recognised by the
+// current command, which may be declared on the command or any of its
+// ancestors, or nil if there is no such field
+func (p *Parser) passthrough() *spec {
+	for cmd := p.curCmd; cmd != nil; cmd = cmd.parent {
+		if cmd.passthrough != nil {
+			return cmd.passthrough
+		}
+	}
+	return nil
+}
+
+// appendPassthrough stores arguments in a passthrough field, replacing any
+// default value the first time
+func (p *Parser) appendPassthrough(spec *spec, values []string, seen map[*spec]bool) error {
+	err := setSlice(p.val(spec.dest), values, !seen[spec])
+	if err != nil {
+		return fmt.Errorf("error processing %s: %v", spec.long, err)
+	}
+	p.record(spec, OriginCommandLine, strings.ToUpper(spec.long), values, !seen[spec])
+	seen[spec] = true
+	p.wasPresent[spec] = true
 	return nil
 }
 
+// positionalCapacity returns the number of positional arguments that the given
+// specs can hold, or -1 if there is no limit
+func positionalCapacity(specs []*spec) int {
+	var n int
+	for _, spec := range specs {
+		if !spec.positional {
+			continue
+		}
+		if spec.multiple {
+			return -1
+		}
+		n++
+	}
+	return n
+}
+
 func nextIsNumeric(t reflect.Type, s string) bool {
 	switch t.Kind() {
 	case reflect.Ptr:
@@ -647,6 +1417,27 @@ func nextIsNumeric(t reflect.Type, s string) bool {
 	}
 }
 
+// isInteger returns true if the type is a signed or unsigned integer
+func isInteger(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	default:
+		return false
+	}
+}
+
+// increment adds one to an integer value
+func increment(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(v.Int() + 1)
+	default:
+		v.SetUint(v.Uint() + 1)
+	}
+}
+
 // isFlag returns true if a token is a flag such as "-v" or "--user" but not "-" or "--"
 func isFlag(s string) bool {
 	return strings.HasPrefix(s, "-") && strings.TrimLeft(s, "-") != ""
@@ -682,6 +1473,10 @@ func setSlice(dest reflect.Value, values []string, trunc bool) error {
 		return fmt.Errorf("field is not writable")
 	}
 
+	if dest.Kind() == reflect.Map {
+		return setMap(dest, values, trunc)
+	}
+
 	var ptr bool
 	elem := dest.Type().Elem()
 	if elem.Kind() == reflect.Ptr && !elem.Implements(textUnmarshalerType) {
@@ -707,6 +1502,31 @@ func setSlice(dest reflect.Value, values []string, trunc bool) error {
 	return nil
 }
 
+// parse key=value pairs as the appropriate types and store them in a map
+func setMap(dest reflect.Value, values []string, trunc bool) error {
+	// Replace the map rather than clearing it so that a default map is not modified
+	if trunc || dest.IsNil() {
+		dest.Set(reflect.MakeMap(dest.Type()))
+	}
+
+	for _, s := range values {
+		pos := strings.Index(s, "=")
+		if pos == -1 {
+			return fmt.Errorf("%q is not of the form key=value", s)
+		}
+		key := reflect.New(dest.Type().Key()).Elem()
+		if err := scalar.ParseValue(key, s[:pos]); err != nil {
+			return err
+		}
+		val := reflect.New(dest.Type().Elem()).Elem()
+		if err := scalar.ParseValue(val, s[pos+1:]); err != nil {
+			return err
+		}
+		dest.SetMapIndex(key, val)
+	}
+	return nil
+}
+
 // findOption finds an option from its name, or returns null if no spec is found
 func findOption(specs []*spec, name string) *spec {
 	for _, spec := range specs {
@@ -720,6 +1540,115 @@ func findOption(specs []*spec, name string) *spec {
 	return nil
 }
 
+// findNegatedOption finds a boolean option from a name of the form "no-foo",
+// or returns nil if there is no such option or it cannot be negated
+func findNegatedOption(specs []*spec, name string) *spec {
+	if !strings.HasPrefix(name, "no-") {
+		return nil
+	}
+	for _, spec := range specs {
+		if spec.negatable && spec.long == name[3:] {
+			return spec
+		}
+	}
+	return nil
+}
+
+// findOptionByPrefix finds an option whose long name, or negated long name,
+// starts with the given prefix. It returns an error listing the candidates if
+// more than one option matches.
+func findOptionByPrefix(specs []*spec, prefix string) (*spec, bool, error) {
+	var found *spec
+	var negated bool
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		// the same name may appear on a command and one of its subcommands, in
+		// which case findOption would pick the first one, so do the same here
+		if spec.positional || seen[spec.long] {
+			continue
+		}
+		seen[spec.long] = true
+
+		if strings.HasPrefix(spec.long, prefix) {
+			found, negated = spec, false
+			candidates = append(candidates, "--"+spec.long)
+		}
+		if spec.negatable && strings.HasPrefix("no-"+spec.long, prefix) {
+			found, negated = spec, true
+			candidates = append(candidates, "--no-"+spec.long)
+		}
+	}
+	if len(candidates) > 1 {
+		return nil, false, fmt.Errorf("ambiguous option --%s could match %s",
+			prefix, strings.Join(candidates, ", "))
+	}
+	return found, negated, nil
+}
+
+// expandShortFlags splits a cluster of short options such as "-abc" into
+// separate tokens "-a", "-b" and "-c". The first option in the cluster that
+// takes a value consumes the rest of the token, so "-vofile" becomes "-v" and
+// "-o=file". It returns nil if the token is not a valid cluster.
+func expandShortFlags(specs []*spec, arg string) []string {
+	if strings.HasPrefix(arg, "--") || len(arg) < 3 {
+		return nil
+	}
+
+	// a value given with an equals sign belongs to the last option in the cluster
+	name := arg[1:]
+	var value string
+	var hasValue bool
+	if pos := strings.Index(name, "="); pos != -1 {
+		value = name[pos+1:]
+		name = name[:pos]
+		hasValue = true
+	}
+	if name == "" {
+		return nil
+	}
+
+	var out []string
+	for i := 0; i < len(name); i++ {
+		short := name[i : i+1]
+		spec := findOption(specs, short)
+		if spec == nil {
+			if short == "h" {
+				out = append(out, "-h")
+				continue
+			}
+			return nil
+		}
+
+		if (spec.boolean || spec.counter) && !spec.multiple {
+			out = append(out, "-"+short)
+			continue
+		}
+
+		// this option takes a value so the remainder of the token is its value
+		rest := name[i+1:]
+		if hasValue {
+			if rest != "" {
+				rest += "="
+			}
+			rest += value
+			hasValue = false
+		}
+		if rest == "" {
+			// the value is the next argument, as in "-vo file"
+			out = append(out, "-"+short)
+		} else {
+			out = append(out, "-"+short+"="+rest)
+		}
+		return out
+	}
+
+	if hasValue {
+		out[len(out)-1] += "=" + value
+	}
+	return out
+}
+
 // findSubcommand finds a subcommand using its name, or returns null if no subcommand is found
 func findSubcommand(cmds []*command, name string) *command {
 	for _, cmd := range cmds {
@@ -730,6 +1659,25 @@ func findSubcommand(cmds []*command, name string) *command {
 	return nil
 }
 
+// findSubcommandByPrefix finds a subcommand whose name starts with the given
+// prefix. It returns an error listing the candidates if more than one
+// subcommand matches.
+func findSubcommandByPrefix(cmds []*command, prefix string) (*command, error) {
+	var found *command
+	var candidates []string
+	for _, cmd := range cmds {
+		if strings.HasPrefix(cmd.name, prefix) {
+			found = cmd
+			candidates = append(candidates, cmd.name)
+		}
+	}
+	if len(candidates) > 1 {
+		return nil, fmt.Errorf("ambiguous subcommand %s could match %s",
+			prefix, strings.Join(candidates, ", "))
+	}
+	return found, nil
+}
+
 // appendUniqSpecs will append to "to" specs from "from" not found in "to"
 func appendUniqSpecs(to []*spec, from []*spec) []*spec {
 	ret := []*spec{}
@@ -745,3 +1693,40 @@ func appendUniqSpecs(to []*spec, from []*spec) []*spec {
 	}
 	return ret
 }
+
+// lookupEnv looks up an environment variable using the function given in the
+// Config, if any, and then in the variables read from dotenv files
+func (p *Parser) lookupEnv(key string) (string, bool) {
+	lookup := p.config.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	if value, ok := lookup(key); ok {
+		return value, true
+	}
+	value, ok := p.dotenv[key]
+	return value, ok
+}
+
+// validate calls Validate on each subcommand struct that was instantiated,
+// innermost first, and then on the destination structs. If one fails then
+// lastCmd is set to its command so that the right usage is shown.
+func (p *Parser) validate() error {
+	for cmd := p.lastCmd; cmd != nil && cmd.parent != nil; cmd = cmd.parent {
+		if v, ok := p.val(cmd.dest).Interface().(Validatable); ok {
+			if err := v.Validate(); err != nil {
+				p.lastCmd = cmd
+				return err
+			}
+		}
+	}
+	for i := len(p.roots) - 1; i >= 0; i-- {
+		if v, ok := p.roots[i].Interface().(Validatable); ok {
+			if err := v.Validate(); err != nil {
+				p.lastCmd = p.cmd
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package arg
 
 import (
+	"bytes"
+	"errors"
 	"net"
 	"net/mail"
 	"os"
@@ -47,6 +49,18 @@ func pparsename(name string, cmdline string, dest interface{}) (*Parser, error)
 	return p, p.Parse(parts)
 }
 
+func pparseconfig(config Config, cmdline string, dest interface{}) (*Parser, error) {
+	p, err := NewParser(config, dest)
+	if err != nil {
+		return nil, err
+	}
+	var parts []string
+	if len(cmdline) > 0 {
+		parts = strings.Split(cmdline, " ")
+	}
+	return p, p.Parse(parts)
+}
+
 func TestString(t *testing.T) {
 	var args struct {
 		Foo string
@@ -1057,3 +1071,1074 @@ func TestVersion(t *testing.T) {
 	assert.Equal(t, ErrVersion, err)
 
 }
+
+func TestShortFlagCluster(t *testing.T) {
+	var args struct {
+		X bool `arg:"-x"`
+		Z bool `arg:"-z"`
+		V bool `arg:"-v"`
+		F string
+	}
+	err := parse("-xz -f foo", &args)
+	require.NoError(t, err)
+	assert.True(t, args.X)
+	assert.True(t, args.Z)
+	assert.False(t, args.V)
+	assert.Equal(t, "foo", args.F)
+}
+
+func TestShortFlagClusterWithValue(t *testing.T) {
+	var args struct {
+		X    bool   `arg:"-x"`
+		Z    bool   `arg:"-z"`
+		File string `arg:"-f"`
+	}
+	err := parse("-xzf archive.tar", &args)
+	require.NoError(t, err)
+	assert.True(t, args.X)
+	assert.True(t, args.Z)
+	assert.Equal(t, "archive.tar", args.File)
+}
+
+func TestShortFlagClusterWithAttachedValue(t *testing.T) {
+	var args struct {
+		X    bool   `arg:"-x"`
+		File string `arg:"-f"`
+	}
+	err := parse("-xfarchive.tar", &args)
+	require.NoError(t, err)
+	assert.True(t, args.X)
+	assert.Equal(t, "archive.tar", args.File)
+}
+
+func TestShortFlagClusterWithEquals(t *testing.T) {
+	var args struct {
+		X    bool   `arg:"-x"`
+		File string `arg:"-f"`
+	}
+	err := parse("-xf=archive.tar", &args)
+	require.NoError(t, err)
+	assert.True(t, args.X)
+	assert.Equal(t, "archive.tar", args.File)
+}
+
+func TestShortFlagAttachedValue(t *testing.T) {
+	var args struct {
+		Output string `arg:"-o"`
+		Define string `arg:"-D"`
+	}
+	err := parse("-ofile.txt -Dkey=value", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "file.txt", args.Output)
+	assert.Equal(t, "key=value", args.Define)
+}
+
+func TestShortFlagAttachedNegativeValue(t *testing.T) {
+	var args struct {
+		V bool `arg:"-v"`
+		N int  `arg:"-n"`
+	}
+	err := parse("-n-5", &args)
+	require.NoError(t, err)
+	assert.Equal(t, -5, args.N)
+
+	err = parse("-vn -7", &args)
+	require.NoError(t, err)
+	assert.True(t, args.V)
+	assert.Equal(t, -7, args.N)
+}
+
+func TestShortFlagAttachedSliceValue(t *testing.T) {
+	var args struct {
+		Include []string `arg:"-I,separate"`
+		Libs    []string `arg:"-l"`
+	}
+	err := parse("-I/usr/include -I/opt/include -lm", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/usr/include", "/opt/include"}, args.Include)
+	assert.Equal(t, []string{"m"}, args.Libs)
+}
+
+func TestShortFlagClusterBoolSlice(t *testing.T) {
+	var args struct {
+		V     bool   `arg:"-v"`
+		Flags []bool `arg:"-b"`
+	}
+	err := parse("-vb true false", &args)
+	require.NoError(t, err)
+	assert.True(t, args.V)
+	assert.Equal(t, []bool{true, false}, args.Flags)
+}
+
+func TestShortFlagClusterMissingValue(t *testing.T) {
+	var args struct {
+		X    bool   `arg:"-x"`
+		File string `arg:"-f"`
+	}
+	err := parse("-xf", &args)
+	assert.EqualError(t, err, "missing value for -f")
+}
+
+func TestShortFlagClusterUnknown(t *testing.T) {
+	var args struct {
+		X bool `arg:"-x"`
+		Z bool `arg:"-z"`
+	}
+	err := parse("-xq", &args)
+	assert.EqualError(t, err, "unknown argument -xq")
+
+	err = parse("-=x", &args)
+	assert.EqualError(t, err, "unknown argument -=x")
+}
+
+func TestShortFlagClusterWithHelp(t *testing.T) {
+	var args struct {
+		X bool `arg:"-x"`
+	}
+	err := parse("-xh", &args)
+	assert.Equal(t, ErrHelp, err)
+}
+
+func TestShortFlagClusterPrefersLongName(t *testing.T) {
+	var args struct {
+		Abc bool
+		A   bool `arg:"-a"`
+		B   bool `arg:"-b"`
+		C   bool `arg:"-c"`
+	}
+	err := parse("-abc", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Abc)
+	assert.False(t, args.A)
+	assert.False(t, args.B)
+	assert.False(t, args.C)
+}
+
+func TestNegatedBool(t *testing.T) {
+	var args struct {
+		Foo bool
+		Bar bool
+	}
+	args.Foo = true
+	err := parse("--no-foo --bar", &args)
+	require.NoError(t, err)
+	assert.False(t, args.Foo)
+	assert.True(t, args.Bar)
+}
+
+func TestNegatedBoolPtr(t *testing.T) {
+	var args struct {
+		Foo *bool
+	}
+	err := parse("--no-foo", &args)
+	require.NoError(t, err)
+	require.NotNil(t, args.Foo)
+	assert.False(t, *args.Foo)
+}
+
+func TestNegatedBoolLastWins(t *testing.T) {
+	var args struct {
+		Foo bool
+	}
+	err := parse("--no-foo --foo", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Foo)
+
+	err = parse("--foo --no-foo", &args)
+	require.NoError(t, err)
+	assert.False(t, args.Foo)
+}
+
+func TestNegatedBoolWithValue(t *testing.T) {
+	var args struct {
+		Foo bool
+	}
+	err := parse("--no-foo=true", &args)
+	assert.EqualError(t, err, "--no-foo=true does not take a value")
+}
+
+func TestNegatedBoolOptOut(t *testing.T) {
+	var args struct {
+		Foo bool `arg:"nonegate"`
+	}
+	err := parse("--no-foo", &args)
+	assert.EqualError(t, err, "unknown argument --no-foo")
+}
+
+func TestNegatedNonBool(t *testing.T) {
+	var args struct {
+		Foo string
+	}
+	err := parse("--no-foo", &args)
+	assert.EqualError(t, err, "unknown argument --no-foo")
+}
+
+func TestNegatedBoolExactMatchWins(t *testing.T) {
+	var args struct {
+		Foo   bool
+		NoFoo bool `arg:"--no-foo"`
+	}
+	args.Foo = true
+	err := parse("--no-foo", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Foo)
+	assert.True(t, args.NoFoo)
+}
+
+func TestNegatedBoolOverridesEnv(t *testing.T) {
+	var args struct {
+		Cache bool `arg:"env"`
+	}
+	setenv(t, "CACHE", "true")
+	os.Args = []string{"example", "--no-cache"}
+	MustParse(&args)
+	assert.False(t, args.Cache)
+}
+
+func TestNegatedBoolInSubcommand(t *testing.T) {
+	type listCmd struct {
+		Color bool
+	}
+	var args struct {
+		List *listCmd `arg:"subcommand"`
+	}
+	err := parse("list --no-color", &args)
+	require.NoError(t, err)
+	require.NotNil(t, args.List)
+	assert.False(t, args.List.Color)
+}
+
+func TestCounter(t *testing.T) {
+	var args struct {
+		Verbose int   `arg:"-v,counter"`
+		Quiet   uint8 `arg:"-q,counter"`
+	}
+	err := parse("-v -v --verbose -q", &args)
+	require.NoError(t, err)
+	assert.Equal(t, 3, args.Verbose)
+	assert.EqualValues(t, 1, args.Quiet)
+}
+
+func TestCounterCluster(t *testing.T) {
+	var args struct {
+		Verbose int    `arg:"-v,counter"`
+		Output  string `arg:"-o"`
+	}
+	err := parse("-vvv -vvo out.txt", &args)
+	require.NoError(t, err)
+	assert.Equal(t, 5, args.Verbose)
+	assert.Equal(t, "out.txt", args.Output)
+}
+
+func TestCounterWithValue(t *testing.T) {
+	var args struct {
+		Verbose int `arg:"-v,counter"`
+	}
+	err := parse("--verbose=4 -v", &args)
+	require.NoError(t, err)
+	assert.Equal(t, 5, args.Verbose)
+}
+
+func TestCounterDoesNotConsumeNext(t *testing.T) {
+	var args struct {
+		Verbose int    `arg:"-v,counter"`
+		Input   string `arg:"positional"`
+	}
+	err := parse("-v 3", &args)
+	require.NoError(t, err)
+	assert.Equal(t, 1, args.Verbose)
+	assert.Equal(t, "3", args.Input)
+}
+
+func TestCounterFromEnv(t *testing.T) {
+	var args struct {
+		Verbose int `arg:"-v,counter,env:VERBOSITY"`
+	}
+	setenv(t, "VERBOSITY", "2")
+	os.Args = []string{"example", "-v"}
+	MustParse(&args)
+	assert.Equal(t, 3, args.Verbose)
+}
+
+func TestCounterNotInteger(t *testing.T) {
+	var args struct {
+		Verbose string `arg:"counter"`
+	}
+	err := parse("", &args)
+	assert.Error(t, err)
+}
+
+func TestAbbreviatedOption(t *testing.T) {
+	var args struct {
+		Verbose bool
+		Output  string
+	}
+	_, err := pparseconfig(Config{AllowAbbreviations: true}, "--verb --out=x.txt", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Verbose)
+	assert.Equal(t, "x.txt", args.Output)
+}
+
+func TestAbbreviatedOptionDisabledByDefault(t *testing.T) {
+	var args struct {
+		Verbose bool
+	}
+	err := parse("--verb", &args)
+	assert.EqualError(t, err, "unknown argument --verb")
+}
+
+func TestAbbreviatedOptionAmbiguous(t *testing.T) {
+	var args struct {
+		Verbose bool
+		Version string
+	}
+	_, err := pparseconfig(Config{AllowAbbreviations: true}, "--ver", &args)
+	assert.EqualError(t, err, "ambiguous option --ver could match --verbose, --version")
+}
+
+func TestAbbreviatedOptionExactMatchWins(t *testing.T) {
+	var args struct {
+		Port     int
+		PortName string
+	}
+	_, err := pparseconfig(Config{AllowAbbreviations: true}, "--port 80", &args)
+	require.NoError(t, err)
+	assert.Equal(t, 80, args.Port)
+	assert.Equal(t, "", args.PortName)
+}
+
+func TestAbbreviatedNegatedOption(t *testing.T) {
+	var args struct {
+		Cache bool
+	}
+	args.Cache = true
+	_, err := pparseconfig(Config{AllowAbbreviations: true}, "--no-ca", &args)
+	require.NoError(t, err)
+	assert.False(t, args.Cache)
+}
+
+func TestAbbreviatedOptionNotForSingleHyphen(t *testing.T) {
+	var args struct {
+		Verbose bool
+	}
+	_, err := pparseconfig(Config{AllowAbbreviations: true}, "-verb", &args)
+	assert.EqualError(t, err, "unknown argument -verb")
+}
+
+func TestOptionalValue(t *testing.T) {
+	var args struct {
+		Color string   `arg:"-c,optional:auto"`
+		Files []string `arg:"positional"`
+	}
+	err := parse("--color x.txt", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "auto", args.Color)
+	assert.Equal(t, []string{"x.txt"}, args.Files)
+}
+
+func TestOptionalValueGiven(t *testing.T) {
+	var args struct {
+		Color string `arg:"-c,optional:auto"`
+	}
+	err := parse("--color=always", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "always", args.Color)
+
+	err = parse("-c=never", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "never", args.Color)
+
+	err = parse("-calways", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "always", args.Color)
+}
+
+func TestOptionalValueNotGiven(t *testing.T) {
+	var args struct {
+		Color string `arg:"optional:auto"`
+	}
+	args.Color = "never"
+	err := parse("", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "never", args.Color)
+}
+
+func TestOptionalValueInCluster(t *testing.T) {
+	var args struct {
+		Verbose bool   `arg:"-v"`
+		Color   string `arg:"-c,optional:auto"`
+	}
+	err := parse("-vc", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Verbose)
+	assert.Equal(t, "auto", args.Color)
+}
+
+func TestOptionalValueInt(t *testing.T) {
+	var args struct {
+		Jobs *int `arg:"-j,optional:4"`
+	}
+	err := parse("-j", &args)
+	require.NoError(t, err)
+	require.NotNil(t, args.Jobs)
+	assert.Equal(t, 4, *args.Jobs)
+
+	err = parse("-j=xyz", &args)
+	assert.Error(t, err)
+}
+
+func TestOptionalValueInvalidBareValue(t *testing.T) {
+	var args struct {
+		Jobs int `arg:"optional:many"`
+	}
+	err := parse("", &args)
+	assert.Error(t, err)
+}
+
+func TestOptionalValueOnSlice(t *testing.T) {
+	var args struct {
+		Colors []string `arg:"optional:auto"`
+	}
+	err := parse("", &args)
+	assert.Error(t, err)
+}
+
+func TestNargs(t *testing.T) {
+	var args struct {
+		Point []float64 `arg:"-p,nargs:2"`
+		Files []string  `arg:"positional"`
+	}
+	err := parse("--point 1 2 a.txt -p 3.5 -4 b.txt", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 2, 3.5, -4}, args.Point)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, args.Files)
+}
+
+func TestNargsWithEquals(t *testing.T) {
+	var args struct {
+		Range []int `arg:"nargs:2"`
+	}
+	err := parse("--range=1 5", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 5}, args.Range)
+}
+
+func TestNargsReplacesDefault(t *testing.T) {
+	var args struct {
+		Range []int `arg:"nargs:2"`
+	}
+	args.Range = []int{0, 10}
+	err := parse("--range 1 5 --range 7 9", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 5, 7, 9}, args.Range)
+}
+
+func TestNargsTooFew(t *testing.T) {
+	var args struct {
+		Point []int `arg:"nargs:3"`
+		Debug bool
+	}
+	err := parse("--point 1 2 --debug", &args)
+	assert.EqualError(t, err, "--point requires 3 values but got 2")
+
+	err = parse("--point 1", &args)
+	assert.EqualError(t, err, "--point requires 3 values but got 1")
+}
+
+func TestNargsInvalid(t *testing.T) {
+	var args struct {
+		Point []int `arg:"nargs:zero"`
+	}
+	err := parse("", &args)
+	assert.Error(t, err)
+}
+
+func TestNargsNotSlice(t *testing.T) {
+	var args struct {
+		Point int `arg:"nargs:2"`
+	}
+	err := parse("", &args)
+	assert.Error(t, err)
+}
+
+func TestNargsFromEnv(t *testing.T) {
+	var args struct {
+		Point []int `arg:"env,nargs:2"`
+	}
+	setenv(t, "POINT", "1,2,3,4")
+	os.Args = []string{"example"}
+	err := Parse(&args)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3, 4}, args.Point)
+
+	setenv(t, "POINT", "1,2,3")
+	err = Parse(&args)
+	assert.Error(t, err)
+}
+
+func TestMap(t *testing.T) {
+	var args struct {
+		Label map[string]string
+		Limit map[string]int
+	}
+	err := parse("--label env=prod --label tier=web zone=a --limit cpu=2", &args)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "tier": "web", "zone": "a"}, args.Label)
+	assert.Equal(t, map[string]int{"cpu": 2}, args.Limit)
+}
+
+func TestMapWithEquals(t *testing.T) {
+	var args struct {
+		Header map[string]string `arg:"-H"`
+	}
+	err := parse("--header=Accept=text/html -H=X-Trace=1", &args)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Accept": "text/html", "X-Trace": "1"}, args.Header)
+}
+
+func TestMapSeparate(t *testing.T) {
+	var args struct {
+		Label map[string]string `arg:"-l,separate"`
+		Files []string          `arg:"positional"`
+	}
+	err := parse("-l a=1 x.txt -l b=2 y.txt", &args)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, args.Label)
+	assert.Equal(t, []string{"x.txt", "y.txt"}, args.Files)
+}
+
+func TestMapWithDefault(t *testing.T) {
+	var args struct {
+		Label map[string]string
+	}
+	defaults := map[string]string{"env": "dev"}
+	args.Label = defaults
+	err := parse("--label tier=web", &args)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tier": "web"}, args.Label)
+	assert.Equal(t, map[string]string{"env": "dev"}, defaults)
+}
+
+func TestMapTypedKeysAndValues(t *testing.T) {
+	var args struct {
+		Weights map[int]float64
+		Timeout map[string]*time.Duration
+	}
+	err := parse("--weights 1=0.5 2=1.5 --timeout read=3s", &args)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]float64{1: 0.5, 2: 1.5}, args.Weights)
+	require.NotNil(t, args.Timeout["read"])
+	assert.Equal(t, 3*time.Second, *args.Timeout["read"])
+}
+
+func TestMapInvalid(t *testing.T) {
+	var args struct {
+		Weights map[int]float64
+	}
+	err := parse("--weights one=1", &args)
+	assert.Error(t, err)
+
+	err = parse("--weights 1", &args)
+	assert.EqualError(t, err, `error processing --weights: "1" is not of the form key=value`)
+}
+
+func TestMapUnsupportedValue(t *testing.T) {
+	var args struct {
+		Foo map[string][]string
+	}
+	err := parse("", &args)
+	assert.Error(t, err)
+}
+
+func TestMapFromEnv(t *testing.T) {
+	var args struct {
+		Label map[string]string `arg:"env"`
+	}
+	setenv(t, "LABEL", `env=prod,"note=a, b"`)
+	os.Args = []string{"example"}
+	MustParse(&args)
+	assert.Equal(t, map[string]string{"env": "prod", "note": "a, b"}, args.Label)
+}
+
+func TestVariadicPositionalBeforeSingle(t *testing.T) {
+	var args struct {
+		Sources []string `arg:"positional,required"`
+		Dest    string   `arg:"positional,required"`
+	}
+	err := parse("a b c dir", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, args.Sources)
+	assert.Equal(t, "dir", args.Dest)
+}
+
+func TestVariadicPositionalBetweenSingles(t *testing.T) {
+	var args struct {
+		Command string `arg:"positional"`
+		Files   []int  `arg:"positional"`
+		Dest    string `arg:"positional"`
+		Mode    string `arg:"positional"`
+	}
+	err := parse("copy 1 2 dir 0644", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "copy", args.Command)
+	assert.Equal(t, []int{1, 2}, args.Files)
+	assert.Equal(t, "dir", args.Dest)
+	assert.Equal(t, "0644", args.Mode)
+
+	args.Files = nil
+	err = parse("copy dir 0644", &args)
+	require.NoError(t, err)
+	assert.Empty(t, args.Files)
+	assert.Equal(t, "dir", args.Dest)
+	assert.Equal(t, "0644", args.Mode)
+}
+
+func TestVariadicPositionalTooFew(t *testing.T) {
+	var args struct {
+		Sources []string `arg:"positional,required"`
+		Dest    string   `arg:"positional,required"`
+	}
+	err := parse("dir", &args)
+	assert.EqualError(t, err, "sources is required")
+
+	err = parse("", &args)
+	assert.EqualError(t, err, "sources is required")
+}
+
+func TestVariadicPositionalMixedWithOptions(t *testing.T) {
+	var args struct {
+		Sources   []string `arg:"positional"`
+		Dest      string   `arg:"positional"`
+		Recursive bool     `arg:"-r"`
+	}
+	err := parse("a -r b dir", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, args.Sources)
+	assert.Equal(t, "dir", args.Dest)
+	assert.True(t, args.Recursive)
+}
+
+func TestPassthrough(t *testing.T) {
+	var args struct {
+		Verbose bool `arg:"-v"`
+		Host    string
+		Extra   []string `arg:"passthrough"`
+	}
+	err := parse("-o StrictHostKeyChecking=no --host example.com --compress -p=2222 -v", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Verbose)
+	assert.Equal(t, "example.com", args.Host)
+	assert.Equal(t, []string{"-o", "StrictHostKeyChecking=no", "--compress", "-p=2222"}, args.Extra)
+}
+
+func TestPassthroughAfterDoubleHyphen(t *testing.T) {
+	var args struct {
+		Verbose bool     `arg:"-v"`
+		Pkg     string   `arg:"positional"`
+		Extra   []string `arg:"passthrough"`
+	}
+	err := parse("--bench ./pkg -v -- -run TestFoo -v", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Verbose)
+	assert.Equal(t, "./pkg", args.Pkg)
+	assert.Equal(t, []string{"--bench", "-run", "TestFoo", "-v"}, args.Extra)
+}
+
+func TestPassthroughUnknownBeforeDoubleHyphen(t *testing.T) {
+	var args struct {
+		Verbose bool     `arg:"-v"`
+		Extra   []string `arg:"passthrough"`
+	}
+	err := parse("-v --foo bar -x -- -v z", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Verbose)
+	assert.Equal(t, []string{"--foo", "bar", "-x", "-v", "z"}, args.Extra)
+
+	args.Verbose = false
+	err = parse("--foo -- --help", &args)
+	require.NoError(t, err)
+	assert.False(t, args.Verbose)
+	assert.Equal(t, []string{"--foo", "--help"}, args.Extra)
+}
+
+func TestPassthroughDoesNotTakePositional(t *testing.T) {
+	var args struct {
+		Files []string `arg:"positional"`
+		Extra []string `arg:"passthrough"`
+	}
+	err := parse("--unknown a.txt b.txt", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, args.Files)
+	assert.Equal(t, []string{"--unknown"}, args.Extra)
+}
+
+func TestPassthroughReplacesDefault(t *testing.T) {
+	var args struct {
+		Extra []string `arg:"passthrough"`
+	}
+	args.Extra = []string{"--default"}
+	err := parse("--foo --bar", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--foo", "--bar"}, args.Extra)
+}
+
+func TestRemainder(t *testing.T) {
+	var args struct {
+		Verbose bool     `arg:"-v"`
+		Rest    []string `arg:"remainder"`
+	}
+	err := parse("-v --race -v ./... -count=1", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Verbose)
+	assert.Equal(t, []string{"--race", "-v", "./...", "-count=1"}, args.Rest)
+}
+
+func TestRemainderAtPositional(t *testing.T) {
+	var args struct {
+		Command string   `arg:"positional"`
+		Verbose bool     `arg:"-v"`
+		Rest    []string `arg:"remainder"`
+	}
+	err := parse("-v ls -l -v /tmp", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Verbose)
+	assert.Equal(t, "ls", args.Command)
+	assert.Equal(t, []string{"-l", "-v", "/tmp"}, args.Rest)
+
+	err = parse("ls /tmp -v", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/tmp", "-v"}, args.Rest)
+}
+
+func TestPassthroughInvalidType(t *testing.T) {
+	var args struct {
+		Extra []int `arg:"passthrough"`
+	}
+	err := parse("", &args)
+	assert.Error(t, err)
+}
+
+func TestPassthroughOnlyOne(t *testing.T) {
+	var args struct {
+		Extra []string `arg:"passthrough"`
+		Rest  []string `arg:"remainder"`
+	}
+	err := parse("", &args)
+	assert.Error(t, err)
+}
+
+func TestToUpperSnake(t *testing.T) {
+	for in, out := range map[string]string{
+		"Foo":        "FOO",
+		"MaxRetries": "MAX_RETRIES",
+		"HTTPPort":   "HTTP_PORT",
+		"ID":         "ID",
+		"UserID":     "USER_ID",
+		"Retry2Max":  "RETRY2_MAX",
+		"dry-run":    "DRY_RUN",
+		"snake_case": "SNAKE_CASE",
+	} {
+		assert.Equal(t, out, toUpperSnake(in), "converting %s", in)
+	}
+}
+
+func TestEnvPrefix(t *testing.T) {
+	var args struct {
+		MaxRetries int
+		Name       string `arg:"env:CUSTOM_NAME"`
+		Secret     string `arg:"noenv"`
+		Input      string `arg:"positional"`
+	}
+	setenv(t, "APP_MAX_RETRIES", "5")
+	setenv(t, "CUSTOM_NAME", "custom")
+	setenv(t, "APP_SECRET", "leaked")
+	setenv(t, "APP_INPUT", "leaked")
+	defer os.Unsetenv("APP_MAX_RETRIES")
+	defer os.Unsetenv("CUSTOM_NAME")
+	defer os.Unsetenv("APP_SECRET")
+	defer os.Unsetenv("APP_INPUT")
+
+	_, err := pparseconfig(Config{EnvPrefix: "APP"}, "", &args)
+	require.NoError(t, err)
+	assert.Equal(t, 5, args.MaxRetries)
+	assert.Equal(t, "custom", args.Name)
+	assert.Equal(t, "", args.Secret)
+	assert.Equal(t, "", args.Input)
+}
+
+func TestEnvPrefixOverriddenByCommandLine(t *testing.T) {
+	var args struct {
+		MaxRetries int
+	}
+	setenv(t, "APP_MAX_RETRIES", "5")
+	defer os.Unsetenv("APP_MAX_RETRIES")
+
+	_, err := pparseconfig(Config{EnvPrefix: "APP"}, "--maxretries 7", &args)
+	require.NoError(t, err)
+	assert.Equal(t, 7, args.MaxRetries)
+}
+
+func TestDefaultTag(t *testing.T) {
+	var args struct {
+		Foo   string        `default:"abc"`
+		Count int           `default:"3"`
+		Names []string      `default:"alice,bob"`
+		Ptr   *int          `default:"5"`
+		Wait  time.Duration `default:"2s"`
+	}
+	err := parse("", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", args.Foo)
+	assert.Equal(t, 3, args.Count)
+	assert.Equal(t, []string{"alice", "bob"}, args.Names)
+	require.NotNil(t, args.Ptr)
+	assert.Equal(t, 5, *args.Ptr)
+	assert.Equal(t, 2*time.Second, args.Wait)
+}
+
+func TestDefaultTagOverridden(t *testing.T) {
+	var args struct {
+		Foo   string   `default:"abc"`
+		Bar   string   `arg:"env" default:"abc"`
+		Names []string `default:"alice,bob"`
+	}
+	setenv(t, "BAR", "fromenv")
+	defer os.Unsetenv("BAR")
+
+	os.Args = []string{"example"}
+	err := parse("--foo xyz --names carol", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", args.Foo)
+	assert.Equal(t, "fromenv", args.Bar)
+	assert.Equal(t, []string{"carol"}, args.Names)
+}
+
+func TestDefaultTagSeparateOverridden(t *testing.T) {
+	var args struct {
+		Names []string `arg:"separate" default:"alice,bob"`
+		Tags  []string `arg:"separate,env" default:"x"`
+	}
+	setenv(t, "TAGS", "y,z")
+	defer os.Unsetenv("TAGS")
+
+	os.Args = []string{"example"}
+	err := parse("--names carol --names dave", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"carol", "dave"}, args.Names)
+	assert.Equal(t, []string{"y", "z"}, args.Tags)
+
+	args.Names, args.Tags = nil, nil
+	err = parse("", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, args.Names)
+}
+
+func TestDefaultTagOnSubcommand(t *testing.T) {
+	type getCmd struct {
+		Retries int `default:"4"`
+	}
+	var args struct {
+		Get *getCmd `arg:"subcommand"`
+	}
+	err := parse("get", &args)
+	require.NoError(t, err)
+	require.NotNil(t, args.Get)
+	assert.Equal(t, 4, args.Get.Retries)
+
+	args.Get = nil
+	err = parse("get --retries 1", &args)
+	require.NoError(t, err)
+	require.NotNil(t, args.Get)
+	assert.Equal(t, 1, args.Get.Retries)
+}
+
+func TestDefaultTagWithRequired(t *testing.T) {
+	var args struct {
+		Foo string `arg:"required" default:"abc"`
+	}
+	_, err := NewParser(Config{}, &args)
+	assert.EqualError(t, err, ".Foo: required fields cannot have a default value")
+}
+
+func TestInvalidDefaultTag(t *testing.T) {
+	var args struct {
+		Foo int `default:"abc"`
+	}
+	_, err := NewParser(Config{}, &args)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `.Foo: invalid default value "abc"`)
+}
+
+func TestConfigLookupEnv(t *testing.T) {
+	t.Parallel()
+	var args struct {
+		Foo      string `arg:"env"`
+		Password string `arg:"env,secret"`
+	}
+	env := map[string]string{"FOO": "from-lookup"}
+	config := Config{
+		LookupEnv: func(key string) (string, bool) {
+			value, ok := env[key]
+			return value, ok
+		},
+	}
+	_, err := pparseconfig(config, "", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "from-lookup", args.Foo)
+	assert.Equal(t, "", args.Password)
+}
+
+func TestConfigLookupEnvWithSources(t *testing.T) {
+	t.Parallel()
+	var args struct {
+		Foo string `arg:"env"`
+		Bar string
+	}
+	config := Config{
+		LookupEnv: func(key string) (string, bool) {
+			return "env-" + key, true
+		},
+		Sources: []ValueSource{EnvSource{}, MapSource{"bar": "from-map"}},
+	}
+	_, err := pparseconfig(config, "", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "env-FOO", args.Foo)
+	assert.Equal(t, "from-map", args.Bar)
+}
+
+func TestParserMustParseHelp(t *testing.T) {
+	t.Parallel()
+	var args struct {
+		Foo string
+	}
+	var stdout, stderr bytes.Buffer
+	exitCode := -100
+	p, err := NewParser(Config{
+		Program: "example",
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+		Exit:    func(code int) { exitCode = code },
+	}, &args)
+	require.NoError(t, err)
+
+	p.MustParse([]string{"--help"})
+	assert.Equal(t, 0, exitCode)
+	assert.Contains(t, stdout.String(), "Usage: example [--foo FOO]")
+	assert.Empty(t, stderr.String())
+}
+
+func TestParserMustParseVersion(t *testing.T) {
+	t.Parallel()
+	var stdout bytes.Buffer
+	exitCode := -100
+	p, err := NewParser(Config{
+		Stdout: &stdout,
+		Exit:   func(code int) { exitCode = code },
+	}, &versioned{})
+	require.NoError(t, err)
+
+	p.MustParse([]string{"--version"})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "example 3.2.1\n", stdout.String())
+}
+
+func TestParserMustParseError(t *testing.T) {
+	t.Parallel()
+	var args struct {
+		Foo int
+	}
+	var stdout, stderr bytes.Buffer
+	exitCode := -100
+	p, err := NewParser(Config{
+		Program: "example",
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+		Exit:    func(code int) { exitCode = code },
+	}, &args)
+	require.NoError(t, err)
+
+	p.MustParse([]string{"--foo", "x"})
+	assert.Equal(t, -1, exitCode)
+	assert.Empty(t, stdout.String())
+	assert.Contains(t, stderr.String(), "Usage: example [--foo FOO]\nerror: error processing --foo")
+
+	stderr.Reset()
+	p.Fail("something went wrong")
+	assert.Equal(t, "Usage: example [--foo FOO]\nerror: something went wrong\n", stderr.String())
+}
+
+type validatedRoot struct {
+	Port  int
+	Serve *validatedServe `arg:"subcommand"`
+	calls *[]string       `arg:"-"`
+}
+
+func (r *validatedRoot) Validate() error {
+	*r.calls = append(*r.calls, "root")
+	if r.Port < 0 {
+		return errors.New("port must not be negative")
+	}
+	return nil
+}
+
+type validatedServe struct {
+	Host string
+}
+
+func (s *validatedServe) Validate() error {
+	if s.Host == "" {
+		return errors.New("serve needs --host")
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	var calls []string
+	args := validatedRoot{calls: &calls}
+	err := parse("--port 80", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"root"}, calls)
+
+	err = parse("--port -1", &args)
+	assert.EqualError(t, err, "port must not be negative")
+}
+
+func TestValidateSubcommandFirst(t *testing.T) {
+	var calls []string
+	args := validatedRoot{calls: &calls}
+	err := parse("--port -1 serve", &args)
+	assert.EqualError(t, err, "serve needs --host")
+	assert.Empty(t, calls)
+
+	args.Port = 0
+	err = parse("serve --host localhost", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"root"}, calls)
+}
+
+func TestValidateNotCalledOnError(t *testing.T) {
+	var calls []string
+	args := validatedRoot{calls: &calls}
+	err := parse("--port x", &args)
+	require.Error(t, err)
+	assert.Empty(t, calls)
+}
+
+func TestValidateShowsSubcommandUsage(t *testing.T) {
+	var calls []string
+	args := validatedRoot{calls: &calls}
+	var stderr bytes.Buffer
+	p, err := NewParser(Config{
+		Program: "example",
+		Stderr:  &stderr,
+		Exit:    func(int) {},
+	}, &args)
+	require.NoError(t, err)
+
+	p.MustParse([]string{"serve"})
+	assert.Equal(t, "Usage: example serve [--host HOST]\nerror: serve needs --host\n", stderr.String())
+
+	stderr.Reset()
+	p.MustParse([]string{"--port", "-1"})
+	assert.Equal(t, "Usage: example [--port PORT]\nerror: port must not be negative\n", stderr.String())
+}
@@ -0,0 +1,150 @@
+package arg
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Origin describes where the value of an option came from
+type Origin int
+
+const (
+	// OriginUnset means that the option was not given a value
+	OriginUnset Origin = iota
+	// OriginDefault means that the value came from a default tag
+	OriginDefault
+	// OriginConfigFile means that the value came from a config file
+	OriginConfigFile
+	// OriginEnv means that the value came from an environment variable
+	OriginEnv
+	// OriginSource means that the value came from a ValueSource other than
+	// the environment
+	OriginSource
+	// OriginCommandLine means that the value came from the command line
+	OriginCommandLine
+)
+
+// String returns a short description of the origin, such as "env"
+func (o Origin) String() string {
+	switch o {
+	case OriginDefault:
+		return "default"
+	case OriginConfigFile:
+		return "config file"
+	case OriginEnv:
+		return "env"
+	case OriginSource:
+		return "source"
+	case OriginCommandLine:
+		return "command line"
+	}
+	return "unset"
+}
+
+// Provenance describes where the value of an option came from
+type Provenance struct {
+	// Option is the name of the option as shown in usage, such as "--workers",
+	// or the placeholder of a positional argument, such as "SRC"
+	Option string
+
+	// Path is the location of the field in the destination struct, such as
+	// "args.Get.Limit"
+	Path string
+
+	// Origin is the kind of place the value came from
+	Origin Origin
+
+	// From describes the place the value came from, such as "--workers",
+	// "environment variable WORKERS" or "config file app.json"
+	From string
+
+	// Raw holds the strings the value was parsed from. An option given several
+	// times on the command line has one string per value, and an option set
+	// from the environment or a default tag has a single string.
+	Raw []string
+}
+
+// Source returns the provenance of the option stored at the given pointer,
+// which must point to a field of one of the destination structs, as in
+// p.Source(&args.Workers). It returns false if there is no such option among
+// the options of the root command and of the subcommands that were activated.
+func (p *Parser) Source(ptr interface{}) (Provenance, bool) {
+	target := reflect.ValueOf(ptr)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return Provenance{}, false
+	}
+	for _, spec := range p.activeSpecs() {
+		v := p.val(spec.dest)
+		if !v.IsValid() || !v.CanAddr() {
+			continue
+		}
+		// compare types as well as addresses since the first field of a
+		// struct has the same address as the struct itself
+		if v.Addr().Pointer() == target.Pointer() && v.Type() == target.Type().Elem() {
+			return p.provenanceOf(spec), true
+		}
+	}
+	return Provenance{}, false
+}
+
+// Provenance returns the provenance of every option of the root command and
+// of the subcommands that were activated, in the order they were declared
+func (p *Parser) Provenance() []Provenance {
+	var out []Provenance
+	for _, spec := range p.activeSpecs() {
+		out = append(out, p.provenanceOf(spec))
+	}
+	return out
+}
+
+// activeSpecs returns the specs of the root command and of each subcommand
+// that was activated by the most recent call to Parse
+func (p *Parser) activeSpecs() []*spec {
+	var chain []*command
+	for cmd := p.lastCmd; cmd != nil; cmd = cmd.parent {
+		chain = append([]*command{cmd}, chain...)
+	}
+	if len(chain) == 0 {
+		chain = []*command{p.cmd}
+	}
+	var specs []*spec
+	for _, cmd := range chain {
+		specs = append(specs, cmd.specs...)
+	}
+	return specs
+}
+
+// provenanceOf returns the provenance of the value of an option
+func (p *Parser) provenanceOf(spec *spec) Provenance {
+	prov := Provenance{Option: "--" + spec.long, Path: spec.dest.String()}
+	if spec.positional {
+		prov.Option = strings.ToUpper(spec.long)
+	}
+	if rec, ok := p.origins[spec]; ok {
+		prov.Origin = rec.Origin
+		prov.From = rec.From
+		prov.Raw = append([]string(nil), rec.Raw...)
+		if spec.secret {
+			for i := range prov.Raw {
+				prov.Raw[i] = secretMask
+			}
+		}
+	}
+	return prov
+}
+
+// record notes where the value of an option came from. Unless replace is true,
+// values given on the command line are added to those given before, as for
+// options that accumulate values across several occurrences.
+func (p *Parser) record(spec *spec, origin Origin, from string, raw []string, replace bool) {
+	prev, ok := p.origins[spec]
+	if ok && !replace && origin == OriginCommandLine && prev.Origin == OriginCommandLine {
+		prev.Raw = append(prev.Raw, raw...)
+		return
+	}
+	p.origins[spec] = &Provenance{
+		Origin: origin,
+		From:   from,
+		Raw:    append([]string(nil), raw...),
+	}
+}
@@ -0,0 +1,172 @@
+package arg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenance(t *testing.T) {
+	var args struct {
+		Workers int      `arg:"env"`
+		Level   string   `default:"info"`
+		Tags    []string `arg:"separate"`
+		Verbose bool
+		Quiet   bool
+		Input   string `arg:"positional"`
+	}
+	setenv(t, "WORKERS", "8")
+	defer os.Unsetenv("WORKERS")
+
+	os.Args = []string{"example"}
+	p, err := pparse("--tags a --tags b --verbose in.txt", &args)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Provenance{
+		{Option: "--workers", Path: "args.Workers", Origin: OriginEnv, From: "environment variable WORKERS", Raw: []string{"8"}},
+		{Option: "--level", Path: "args.Level", Origin: OriginDefault, From: "default", Raw: []string{"info"}},
+		{Option: "--tags", Path: "args.Tags", Origin: OriginCommandLine, From: "--tags", Raw: []string{"a", "b"}},
+		{Option: "--verbose", Path: "args.Verbose", Origin: OriginCommandLine, From: "--verbose", Raw: []string{"true"}},
+		{Option: "--quiet", Path: "args.Quiet"},
+		{Option: "INPUT", Path: "args.Input", Origin: OriginCommandLine, From: "INPUT", Raw: []string{"in.txt"}},
+	}, p.Provenance())
+}
+
+func TestProvenanceCommandLineOverridesEnv(t *testing.T) {
+	var args struct {
+		Workers int `arg:"env"`
+	}
+	setenv(t, "WORKERS", "8")
+	defer os.Unsetenv("WORKERS")
+
+	os.Args = []string{"example"}
+	p, err := pparse("--workers=3", &args)
+	require.NoError(t, err)
+
+	prov, ok := p.Source(&args.Workers)
+	require.True(t, ok)
+	assert.Equal(t, OriginCommandLine, prov.Origin)
+	assert.Equal(t, "--workers", prov.From)
+	assert.Equal(t, []string{"3"}, prov.Raw)
+}
+
+func TestProvenanceFromSource(t *testing.T) {
+	var args struct {
+		Token string
+	}
+	p, err := pparseconfig(Config{Sources: []ValueSource{MapSource{"token": "xyz"}}}, "", &args)
+	require.NoError(t, err)
+
+	prov, ok := p.Source(&args.Token)
+	require.True(t, ok)
+	assert.Equal(t, OriginSource, prov.Origin)
+	assert.Equal(t, []string{"xyz"}, prov.Raw)
+}
+
+func TestProvenanceSubcommand(t *testing.T) {
+	type getCmd struct {
+		Limit int `default:"10"`
+		Name  string
+	}
+	type putCmd struct {
+		Force bool
+	}
+	var args struct {
+		Debug bool
+		Get   *getCmd `arg:"subcommand"`
+		Put   *putCmd `arg:"subcommand"`
+	}
+	p, err := pparse("get --name x", &args)
+	require.NoError(t, err)
+
+	var paths []string
+	for _, prov := range p.Provenance() {
+		paths = append(paths, prov.Path)
+	}
+	assert.Equal(t, []string{"args.Debug", "args.Get.Limit", "args.Get.Name"}, paths)
+
+	prov, ok := p.Source(&args.Get.Limit)
+	require.True(t, ok)
+	assert.Equal(t, OriginDefault, prov.Origin)
+
+	prov, ok = p.Source(&args.Get.Name)
+	require.True(t, ok)
+	assert.Equal(t, OriginCommandLine, prov.Origin)
+	assert.Equal(t, []string{"x"}, prov.Raw)
+}
+
+func TestProvenanceMultipleDestinations(t *testing.T) {
+	type getCmd struct {
+		Name string
+	}
+	var a struct {
+		Get *getCmd `arg:"subcommand"`
+	}
+	var b struct {
+		Other string
+	}
+	p, err := NewParser(Config{}, &a, &b)
+	require.NoError(t, err)
+	require.NoError(t, p.Parse([]string{"--other", "x", "get", "--name", "y"}))
+
+	var paths []string
+	for _, prov := range p.Provenance() {
+		paths = append(paths, prov.Path)
+	}
+	assert.Equal(t, []string{"args.Other", "args.Get.Name"}, paths)
+
+	prov, ok := p.Source(&b.Other)
+	require.True(t, ok)
+	assert.Equal(t, OriginCommandLine, prov.Origin)
+	assert.Equal(t, []string{"x"}, prov.Raw)
+}
+
+func TestProvenanceUnknownPointer(t *testing.T) {
+	var args struct {
+		Foo string
+	}
+	p, err := pparse("", &args)
+	require.NoError(t, err)
+
+	var other string
+	_, ok := p.Source(&other)
+	assert.False(t, ok)
+	_, ok = p.Source(args)
+	assert.False(t, ok)
+}
+
+func TestOriginString(t *testing.T) {
+	assert.Equal(t, "unset", OriginUnset.String())
+	assert.Equal(t, "command line", OriginCommandLine.String())
+	assert.Equal(t, "env", OriginEnv.String())
+}
+
+func TestProvenanceConfigFile(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"app.json": `{"tags": ["a", "b"], "level": "debug"}`,
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Config string `arg:"config"`
+		Tags   []string
+		Level  string `default:"info"`
+	}
+	file := filepath.Join(dir, "app.json")
+	p, err := pparse("--config "+file, &args)
+	require.NoError(t, err)
+
+	prov, ok := p.Source(&args.Tags)
+	require.True(t, ok)
+	assert.Equal(t, OriginConfigFile, prov.Origin)
+	assert.Equal(t, "config file "+file, prov.From)
+	assert.Equal(t, []string{"a", "b"}, prov.Raw)
+
+	prov, ok = p.Source(&args.Level)
+	require.True(t, ok)
+	assert.Equal(t, OriginConfigFile, prov.Origin)
+	assert.Equal(t, []string{"debug"}, prov.Raw)
+}
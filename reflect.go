@@ -17,6 +17,14 @@ func canParse(t reflect.Type) (parseable, boolean, multiple bool) {
 		return
 	}
 
+	// Maps are filled from key=value pairs
+	if t.Kind() == reflect.Map {
+		if scalar.CanParse(t.Key()) && scalar.CanParse(t.Elem()) {
+			return true, false, true
+		}
+		return false, false, false
+	}
+
 	// Look inside pointer types
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
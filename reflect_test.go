@@ -53,3 +53,14 @@ func TestCanParseTextUnmarshaler(t *testing.T) {
 	assertCanParse(t, reflect.TypeOf(su), true, false, true)
 	assertCanParse(t, reflect.TypeOf(&su), true, false, true)
 }
+
+func TestCanParseMap(t *testing.T) {
+	var m map[string]int
+	var mp map[int]*float64
+	var ms map[string][]string
+	var mi map[interface{}]string
+	assertCanParse(t, reflect.TypeOf(m), true, false, true)
+	assertCanParse(t, reflect.TypeOf(mp), true, false, true)
+	assertCanParse(t, reflect.TypeOf(ms), false, false, false)
+	assertCanParse(t, reflect.TypeOf(mi), false, false, false)
+}
@@ -0,0 +1,176 @@
+package arg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// expandResponseFiles replaces each argument of the form "@path" with the
+// arguments read from that file. An argument starting with "@@" is kept as a
+// literal argument with the first "@" removed. Arguments after "--", whether
+// on the command line or in a response file, are kept as they are.
+func expandResponseFiles(args []string) ([]string, error) {
+	out, _, err := expandResponseArgs(args, "", nil)
+	return out, err
+}
+
+// expandResponseArgs expands the response files among args. Relative paths
+// are resolved against dir, and stack holds the files currently being
+// expanded so that cycles can be detected. It also reports whether args
+// included a "--", after which nothing more is expanded.
+func expandResponseArgs(args []string, dir string, stack []string) ([]string, bool, error) {
+	var out []string
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return append(out, args[i:]...), true, nil
+		case strings.HasPrefix(arg, "@@"):
+			out = append(out, arg[1:])
+		case strings.HasPrefix(arg, "@") && len(arg) > 1:
+			name := arg[1:]
+			if dir != "" && !filepath.IsAbs(name) {
+				name = filepath.Join(dir, name)
+			}
+			expanded, ended, err := readResponseFile(name, stack)
+			if err != nil {
+				return nil, false, err
+			}
+			out = append(out, expanded...)
+			if ended {
+				return append(out, args[i+1:]...), true, nil
+			}
+		default:
+			out = append(out, arg)
+		}
+	}
+	return out, false, nil
+}
+
+// readResponseFile reads the arguments from a response file, expanding any
+// response files that it refers to in turn, and reports whether it included
+// a "--"
+func readResponseFile(name string, stack []string) ([]string, bool, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading response file %s: %v", name, err)
+	}
+	for i, included := range stack {
+		if included == abs {
+			cycle := append(append([]string{}, stack[i:]...), abs)
+			return nil, false, fmt.Errorf("response file %s includes itself: %s",
+				name, strings.Join(cycle, " -> "))
+		}
+	}
+
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading response file %s: %v", name, err)
+	}
+
+	args, err := splitResponseFile(string(buf))
+	if err != nil {
+		return nil, false, fmt.Errorf("%s:%v", name, err)
+	}
+	return expandResponseArgs(args, filepath.Dir(name), append(stack, abs))
+}
+
+// responseFileError is an error at a particular line of a response file
+type responseFileError struct {
+	line int
+	msg  string
+}
+
+func (e *responseFileError) Error() string {
+	return fmt.Sprintf("%d: %s", e.line, e.msg)
+}
+
+// splitResponseFile splits the contents of a response file into arguments
+// using shell-like rules: arguments are separated by whitespace, single quotes
+// preserve everything up to the closing quote, double quotes allow backslash
+// escapes, a backslash outside quotes escapes the next character, and a "#" at
+// the start of an argument begins a comment that runs to the end of the line.
+func splitResponseFile(s string) ([]string, error) {
+	var args []string
+	var cur []rune
+	var inArg bool // true if cur holds an argument, which may be empty as in ''
+	line := 1
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\n' || r == ' ' || r == '\t' || r == '\r':
+			if inArg {
+				args = append(args, string(cur))
+				cur = cur[:0]
+				inArg = false
+			}
+			if r == '\n' {
+				line++
+			}
+		case r == '#' && !inArg:
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, &responseFileError{line, "backslash at end of file"}
+			}
+			i++
+			if runes[i] == '\n' {
+				// a backslash followed by a newline continues the line
+				line++
+				continue
+			}
+			cur = append(cur, runes[i])
+			inArg = true
+		case r == '\'':
+			start := line
+			i++
+			for ; i < len(runes) && runes[i] != '\''; i++ {
+				if runes[i] == '\n' {
+					line++
+				}
+				cur = append(cur, runes[i])
+			}
+			if i == len(runes) {
+				return nil, &responseFileError{start, "unterminated single quote"}
+			}
+			inArg = true
+		case r == '"':
+			start := line
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				c := runes[i]
+				if c == '\\' && i+1 < len(runes) {
+					switch runes[i+1] {
+					case '"', '\\', '$', '`':
+						i++
+						c = runes[i]
+					case '\n':
+						i++
+						line++
+						continue
+					}
+				}
+				if c == '\n' {
+					line++
+				}
+				cur = append(cur, c)
+			}
+			if i == len(runes) {
+				return nil, &responseFileError{start, "unterminated double quote"}
+			}
+			inArg = true
+		default:
+			cur = append(cur, r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, string(cur))
+	}
+	return args, nil
+}
@@ -0,0 +1,160 @@
+package arg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTempFiles creates a temporary directory containing the given files
+// and returns its path
+func writeTempFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "go-arg")
+	require.NoError(t, err)
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		require.NoError(t, err)
+	}
+	return dir
+}
+
+func TestSplitResponseFile(t *testing.T) {
+	args, err := splitResponseFile(`--foo bar
+# a comment
+	--baz='hello world' "quoted \"string\"" escaped\ space ''
+--x=a#b # trailing comment
+continued\
+line "multi
+line"`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"--foo", "bar",
+		"--baz=hello world", `quoted "string"`, "escaped space", "",
+		"--x=a#b",
+		"continuedline", "multi\nline",
+	}, args)
+}
+
+func TestSplitResponseFileErrors(t *testing.T) {
+	_, err := splitResponseFile("--foo\n--bar 'oops\n\n")
+	assert.EqualError(t, err, "2: unterminated single quote")
+
+	_, err = splitResponseFile("\n\n\"oops")
+	assert.EqualError(t, err, "3: unterminated double quote")
+
+	_, err = splitResponseFile("oops\\")
+	assert.EqualError(t, err, "1: backslash at end of file")
+}
+
+func TestResponseFile(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"args.rsp": "--foo 'hello world'\n--bar 1 2\n",
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Foo  string
+		Bar  []int
+		Baz  bool
+		Rest []string `arg:"positional"`
+	}
+	rsp := filepath.Join(dir, "args.rsp")
+	_, err := pparseconfig(Config{ResponseFiles: true}, "x @"+rsp+" --baz @@y", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", args.Foo)
+	assert.Equal(t, []int{1, 2}, args.Bar)
+	assert.True(t, args.Baz)
+	assert.Equal(t, []string{"x", "@y"}, args.Rest)
+}
+
+func TestResponseFileDisabledByDefault(t *testing.T) {
+	var args struct {
+		Rest []string `arg:"positional"`
+	}
+	err := parse("@args.rsp", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@args.rsp"}, args.Rest)
+}
+
+func TestResponseFileNotExpandedAfterDoubleHyphen(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"args.rsp": "--foo a -- @inner.rsp",
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Foo  string
+		Rest []string `arg:"positional"`
+	}
+	_, err := pparseconfig(Config{ResponseFiles: true}, "-- @literal @@x", &args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@literal", "@@x"}, args.Rest)
+
+	// a "--" in a response file also ends the options on the command line
+	_, err = pparseconfig(Config{ResponseFiles: true}, "@"+filepath.Join(dir, "args.rsp")+" @more", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "a", args.Foo)
+	assert.Equal(t, []string{"@inner.rsp", "@more"}, args.Rest)
+}
+
+func TestResponseFileNested(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"outer.rsp": "--foo a @inner.rsp --baz c",
+		"inner.rsp": "--bar b @@literal",
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Foo  string
+		Bar  []string
+		Baz  string
+		Rest []string `arg:"positional"`
+	}
+	_, err := pparseconfig(Config{ResponseFiles: true}, "@"+filepath.Join(dir, "outer.rsp"), &args)
+	require.NoError(t, err)
+	assert.Equal(t, "a", args.Foo)
+	assert.Equal(t, []string{"b", "@literal"}, args.Bar)
+	assert.Equal(t, "c", args.Baz)
+}
+
+func TestResponseFileCycle(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"a.rsp": "--foo @b.rsp",
+		"b.rsp": "@a.rsp",
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Foo string
+	}
+	_, err := pparseconfig(Config{ResponseFiles: true}, "@"+filepath.Join(dir, "a.rsp"), &args)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "includes itself")
+}
+
+func TestResponseFileMissing(t *testing.T) {
+	var args struct {
+		Foo string
+	}
+	_, err := pparseconfig(Config{ResponseFiles: true}, "@does-not-exist.rsp", &args)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error reading response file does-not-exist.rsp")
+}
+
+func TestResponseFileSyntaxError(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"bad.rsp": "--foo\n'bar",
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Foo string
+	}
+	rsp := filepath.Join(dir, "bad.rsp")
+	_, err := pparseconfig(Config{ResponseFiles: true}, "@"+rsp, &args)
+	assert.EqualError(t, err, rsp+":2: unterminated single quote")
+}
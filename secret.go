@@ -0,0 +1,39 @@
+package arg
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// secretMask replaces the values of secret options wherever they would be shown
+const secretMask = "******"
+
+// secretFileSuffix is added to the long name of a secret option to get the
+// option that reads its value from a file, and to its environment variable to
+// get the variable that holds the path of such a file
+const secretFileSuffix = "-file"
+
+// readSecretFile reads the value of a secret option from a file, ignoring
+// surrounding whitespace such as a trailing newline
+func readSecretFile(name string) (string, error) {
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// findSecretFileOption finds the secret option for something like
+// "password-file", or returns nil if there is no such option
+func findSecretFileOption(specs []*spec, name string) *spec {
+	if !strings.HasSuffix(name, secretFileSuffix) {
+		return nil
+	}
+	long := strings.TrimSuffix(name, secretFileSuffix)
+	for _, spec := range specs {
+		if spec.secret && !spec.positional && spec.long == long {
+			return spec
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package arg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretFromFileEnv(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"db": "hunter2\n",
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Password string `arg:"env:DB_PASSWORD,secret"`
+	}
+	setenv(t, "DB_PASSWORD_FILE", filepath.Join(dir, "db"))
+	defer os.Unsetenv("DB_PASSWORD_FILE")
+
+	os.Args = []string{"example"}
+	p, err := pparse("", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", args.Password)
+
+	prov, ok := p.Source(&args.Password)
+	require.True(t, ok)
+	assert.Equal(t, OriginEnv, prov.Origin)
+	assert.Equal(t, "environment variable DB_PASSWORD_FILE", prov.From)
+	assert.Equal(t, []string{secretMask}, prov.Raw)
+}
+
+func TestSecretEnvTakesPrecedenceOverFile(t *testing.T) {
+	var args struct {
+		Password string `arg:"env:DB_PASSWORD,secret"`
+	}
+	setenv(t, "DB_PASSWORD", "direct")
+	setenv(t, "DB_PASSWORD_FILE", "/does/not/exist")
+	defer os.Unsetenv("DB_PASSWORD")
+	defer os.Unsetenv("DB_PASSWORD_FILE")
+
+	os.Args = []string{"example"}
+	err := parse("", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "direct", args.Password)
+}
+
+func TestSecretFileEnvMissing(t *testing.T) {
+	var args struct {
+		Password string `arg:"env:DB_PASSWORD,secret"`
+	}
+	setenv(t, "DB_PASSWORD_FILE", "/does/not/exist")
+	defer os.Unsetenv("DB_PASSWORD_FILE")
+
+	os.Args = []string{"example"}
+	err := parse("", &args)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error processing environment variable DB_PASSWORD_FILE")
+}
+
+func TestSecretFileOption(t *testing.T) {
+	dir := writeTempFiles(t, map[string]string{
+		"pw": "  s3cret  \n",
+	})
+	defer os.RemoveAll(dir)
+
+	var args struct {
+		Password string `arg:"secret"`
+	}
+	err := parse("--password-file "+filepath.Join(dir, "pw"), &args)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", args.Password)
+
+	args.Password = ""
+	err = parse("--password-file="+filepath.Join(dir, "pw"), &args)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", args.Password)
+
+	err = parse("--password-file", &args)
+	assert.EqualError(t, err, "missing value for --password-file")
+}
+
+func TestSecretFileOptionOnlyForSecrets(t *testing.T) {
+	var args struct {
+		Password string
+	}
+	err := parse("--password-file x", &args)
+	assert.EqualError(t, err, "unknown argument --password-file")
+}
+
+func TestSecretMaskedInErrors(t *testing.T) {
+	var args struct {
+		Pin int `arg:"env:PIN,secret"`
+	}
+	err := parse("--pin 12ab", &args)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "12ab")
+	assert.Contains(t, err.Error(), secretMask)
+
+	setenv(t, "PIN", "34cd")
+	defer os.Unsetenv("PIN")
+	os.Args = []string{"example"}
+	err = parse("", &args)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "34cd")
+	assert.Contains(t, err.Error(), "environment variable PIN")
+
+	var withDefault struct {
+		Pin int `arg:"secret" default:"56ef"`
+	}
+	_, err = NewParser(Config{}, &withDefault)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "56ef")
+}
+
+func TestSecretMaskedOnlyWhereFormatted(t *testing.T) {
+	var args struct {
+		Password string `arg:"secret" pattern:"^[0-9]+$"`
+		Pin      int    `arg:"secret" min:"1000"`
+	}
+	err := parse("--password s", &args)
+	assert.EqualError(t, err, `error processing --password: "******" does not match the pattern ^[0-9]+$`)
+
+	err = parse("--password=s", &args)
+	assert.EqualError(t, err, `error processing --password: "******" does not match the pattern ^[0-9]+$`)
+
+	err = parse("--pin 1", &args)
+	assert.EqualError(t, err, "error processing --pin: ****** is less than the minimum of 1000")
+
+	err = parse("--pin e", &args)
+	assert.EqualError(t, err, `error processing --pin: invalid value "******" for int`)
+}
+
+func TestSecretMultipleNotAllowed(t *testing.T) {
+	var args struct {
+		Keys []string `arg:"secret"`
+	}
+	_, err := NewParser(Config{}, &args)
+	assert.EqualError(t, err, ".Keys: secret fields cannot have multiple values")
+}
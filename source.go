@@ -0,0 +1,71 @@
+package arg
+
+import (
+	"fmt"
+	"os"
+)
+
+// OptionRef identifies an option when looking up its value in a ValueSource
+type OptionRef struct {
+	// Path is the location of the field in the destination struct, such as
+	// "args.Get.Limit"
+	Path string
+
+	// Long is the long name of the option, without the leading hyphens
+	Long string
+
+	// Env is the environment variable bound to the option, or the empty string
+	// if it has none
+	Env string
+}
+
+// ValueSource is the interface implemented by anything that can provide values
+// for options other than the command line, such as the environment.
+type ValueSource interface {
+	// Lookup returns the value for the given option and whether it has one.
+	// Options with multiple values are given as a CSV string.
+	Lookup(ref OptionRef) (value string, found bool, err error)
+}
+
+// EnvSource is a ValueSource that looks up options in environment variables.
+// Only options bound to an environment variable are looked up.
+type EnvSource struct {
+	// LookupEnv looks up environment variables. If nil, the parser uses
+	// Config.LookupEnv, and os.LookupEnv is used outside of a parser.
+	LookupEnv func(key string) (string, bool)
+}
+
+// Lookup returns the value of the environment variable bound to an option
+func (s EnvSource) Lookup(ref OptionRef) (string, bool, error) {
+	if ref.Env == "" {
+		return "", false, nil
+	}
+	lookup := s.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	value, found := lookup(ref.Env)
+	return value, found, nil
+}
+
+// MapSource is a ValueSource that looks up options in a map keyed by their
+// long names
+type MapSource map[string]string
+
+// Lookup returns the value stored under the long name of an option
+func (m MapSource) Lookup(ref OptionRef) (string, bool, error) {
+	value, found := m[ref.Long]
+	return value, found, nil
+}
+
+// describeSource describes where the value of an option came from for use in
+// error messages
+func describeSource(src ValueSource, ref OptionRef) string {
+	if _, ok := src.(EnvSource); ok {
+		return "environment variable " + ref.Env
+	}
+	if s, ok := src.(fmt.Stringer); ok {
+		return fmt.Sprintf("%s value for --%s", s, ref.Long)
+	}
+	return "value for --" + ref.Long
+}
@@ -0,0 +1,128 @@
+package arg
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// vaultSource is a ValueSource that records the options it was asked about
+type vaultSource struct {
+	secrets map[string]string
+	refs    []OptionRef
+}
+
+func (v *vaultSource) Lookup(ref OptionRef) (string, bool, error) {
+	v.refs = append(v.refs, ref)
+	value, found := v.secrets[ref.Path]
+	return value, found, nil
+}
+
+func (v *vaultSource) String() string {
+	return "vault"
+}
+
+type failingSource struct{}
+
+func (failingSource) Lookup(ref OptionRef) (string, bool, error) {
+	return "", false, errors.New("connection refused")
+}
+
+func TestMapSource(t *testing.T) {
+	var args struct {
+		Foo string
+		Bar []int
+		Baz string
+	}
+	args.Baz = "default"
+	config := Config{Sources: []ValueSource{MapSource{"foo": "abc", "bar": "1,2"}}}
+	_, err := pparseconfig(config, "", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", args.Foo)
+	assert.Equal(t, []int{1, 2}, args.Bar)
+	assert.Equal(t, "default", args.Baz)
+}
+
+func TestSourceOrder(t *testing.T) {
+	var args struct {
+		Foo string
+		Bar string
+	}
+	config := Config{Sources: []ValueSource{
+		MapSource{"foo": "first"},
+		MapSource{"foo": "second", "bar": "second"},
+	}}
+	_, err := pparseconfig(config, "", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "first", args.Foo)
+	assert.Equal(t, "second", args.Bar)
+}
+
+func TestSourceOverriddenByCommandLine(t *testing.T) {
+	var args struct {
+		Foo string
+	}
+	config := Config{Sources: []ValueSource{MapSource{"foo": "source"}}}
+	_, err := pparseconfig(config, "--foo cli", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "cli", args.Foo)
+}
+
+func TestSourceSatisfiesRequired(t *testing.T) {
+	var args struct {
+		Token string `arg:"required"`
+	}
+	config := Config{Sources: []ValueSource{MapSource{"token": "xyz"}}}
+	_, err := pparseconfig(config, "", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", args.Token)
+}
+
+func TestSourcesReplaceEnvironment(t *testing.T) {
+	var args struct {
+		Foo string `arg:"env:SOURCE_TEST_FOO"`
+	}
+	setenv(t, "SOURCE_TEST_FOO", "env")
+	defer os.Unsetenv("SOURCE_TEST_FOO")
+
+	_, err := pparseconfig(Config{Sources: []ValueSource{MapSource{}}}, "", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "", args.Foo)
+
+	_, err = pparseconfig(Config{Sources: []ValueSource{MapSource{}, EnvSource{}}}, "", &args)
+	require.NoError(t, err)
+	assert.Equal(t, "env", args.Foo)
+}
+
+func TestCustomSourceInSubcommand(t *testing.T) {
+	type getCmd struct {
+		Password string `arg:"env"`
+	}
+	var args struct {
+		Get *getCmd `arg:"subcommand"`
+	}
+	vault := &vaultSource{secrets: map[string]string{"args.Get.Password": "hunter2"}}
+	_, err := pparseconfig(Config{Sources: []ValueSource{vault}}, "get", &args)
+	require.NoError(t, err)
+	require.NotNil(t, args.Get)
+	assert.Equal(t, "hunter2", args.Get.Password)
+	assert.Equal(t, []OptionRef{{Path: "args.Get.Password", Long: "password", Env: "PASSWORD"}}, vault.refs)
+}
+
+func TestSourceErrors(t *testing.T) {
+	var args struct {
+		Workers int
+	}
+	vault := &vaultSource{secrets: map[string]string{"args.Workers": "many"}}
+	_, err := pparseconfig(Config{Sources: []ValueSource{vault}}, "", &args)
+	assert.EqualError(t, err, `error processing vault value for --workers: strconv.ParseInt: parsing "many": invalid syntax`)
+
+	_, err = pparseconfig(Config{Sources: []ValueSource{MapSource{"workers": "x"}}}, "", &args)
+	assert.EqualError(t, err, `error processing value for --workers: strconv.ParseInt: parsing "x": invalid syntax`)
+
+	_, err = pparseconfig(Config{Sources: []ValueSource{failingSource{}}}, "", &args)
+	assert.EqualError(t, err, "error looking up value for --workers: connection refused")
+}
@@ -119,9 +119,14 @@ const (
 	ForsePostRunOnStrategy
 )
 
-func (p *Parser) Execute(ctx context.Context, strategy ExecutionStrategy) error {
+func (p *Parser) Execute(ctx context.Context, strategy ExecutionStrategy) (err error) {
+	// release the files opened for InputFile and OutputFile options
+	defer func() {
+		if cerr := p.Close(); err == nil {
+			err = cerr
+		}
+	}()
 
-	var err error
 	lastCmd := len(p.execTree) - 1
 	pPostRunners := []PersistentPostRunner{}
 
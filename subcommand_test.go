@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"testing"
 
@@ -378,12 +379,12 @@ type optsB struct {
 	Moo string
 }
 
-var helpB = `Usage: subparser list [--type TYPE] [--name NAME] [--baz] [--moo MOO]
+var helpB = `Usage: subparser list [--type TYPE] [--name NAME] [--[no-]baz] [--moo MOO]
 
 Options:
   --type TYPE [default: b]
   --name NAME
-  --baz
+  --[no-]baz
   --moo MOO
   --help, -h             display this help and exit
 `
@@ -521,3 +522,156 @@ func TestCustomSubCommandParsing(t *testing.T) {
 		assert.Equal(t, "unknown", args.Get.Name)
 	}
 }
+
+func TestAbbreviatedSubcommand(t *testing.T) {
+	type checkoutCmd struct {
+		Branch string `arg:"positional"`
+	}
+	type commitCmd struct {
+		Message string `arg:"-m"`
+	}
+	var args struct {
+		Checkout *checkoutCmd `arg:"subcommand"`
+		Commit   *commitCmd   `arg:"subcommand"`
+	}
+	p, err := pparseconfig(Config{AllowAbbreviations: true}, "chec main", &args)
+	require.NoError(t, err)
+	require.NotNil(t, args.Checkout)
+	assert.Equal(t, "main", args.Checkout.Branch)
+	assert.Equal(t, []string{"checkout"}, p.SubcommandNames())
+
+	_, err = pparseconfig(Config{AllowAbbreviations: true}, "c", &args)
+	assert.EqualError(t, err, "ambiguous subcommand c could match checkout, commit")
+}
+
+func TestAbbreviatedSubcommandExactMatchWins(t *testing.T) {
+	type listCmd struct{}
+	type listAllCmd struct{}
+	var args struct {
+		List    *listCmd    `arg:"subcommand:ls"`
+		ListAll *listAllCmd `arg:"subcommand:lsall"`
+	}
+	_, err := pparseconfig(Config{AllowAbbreviations: true}, "ls", &args)
+	require.NoError(t, err)
+	assert.NotNil(t, args.List)
+	assert.Nil(t, args.ListAll)
+}
+
+func TestAbbreviatedOptionsInNestedSubcommands(t *testing.T) {
+	type childCmd struct {
+		Recursive bool
+	}
+	type parentCmd struct {
+		Format string
+		Child  *childCmd `arg:"subcommand"`
+	}
+	var args struct {
+		Verbose bool
+		Parent  *parentCmd `arg:"subcommand"`
+	}
+	_, err := pparseconfig(Config{AllowAbbreviations: true}, "par chi --rec --form json --verb", &args)
+	require.NoError(t, err)
+	require.NotNil(t, args.Parent)
+	require.NotNil(t, args.Parent.Child)
+	assert.True(t, args.Verbose)
+	assert.Equal(t, "json", args.Parent.Format)
+	assert.True(t, args.Parent.Child.Recursive)
+}
+
+func TestAbbreviatedOptionSharedWithSubcommand(t *testing.T) {
+	type childCmd struct {
+		Verbose bool
+	}
+	var args struct {
+		Verbose bool
+		Child   *childCmd `arg:"subcommand"`
+	}
+	_, err := pparseconfig(Config{AllowAbbreviations: true}, "child --verb", &args)
+	require.NoError(t, err)
+	assert.True(t, args.Verbose)
+}
+
+func TestPassthroughInSubcommand(t *testing.T) {
+	type runCmd struct {
+		Image string   `arg:"positional"`
+		Args  []string `arg:"remainder"`
+	}
+	var args struct {
+		Debug bool
+		Run   *runCmd `arg:"subcommand"`
+	}
+	err := parse("--debug run alpine --rm -it sh", &args)
+	require.NoError(t, err)
+	require.NotNil(t, args.Run)
+	assert.True(t, args.Debug)
+	assert.Equal(t, "alpine", args.Run.Image)
+	assert.Equal(t, []string{"--rm", "-it", "sh"}, args.Run.Args)
+}
+
+func TestPassthroughFromParentCommand(t *testing.T) {
+	type execCmd struct {
+		Verbose bool
+	}
+	var args struct {
+		Exec  *execCmd `arg:"subcommand"`
+		Extra []string `arg:"passthrough"`
+	}
+	err := parse("exec --verbose --unknown=1 --other value", &args)
+	require.NoError(t, err)
+	require.NotNil(t, args.Exec)
+	assert.True(t, args.Exec.Verbose)
+	assert.Equal(t, []string{"--unknown=1", "--other", "value"}, args.Extra)
+}
+
+func TestRemainderAtUnknownSubcommand(t *testing.T) {
+	type listCmd struct{}
+	var args struct {
+		List *listCmd `arg:"subcommand"`
+		Rest []string `arg:"remainder"`
+	}
+	err := parse("plugin --flag", &args)
+	require.NoError(t, err)
+	assert.Nil(t, args.List)
+	assert.Equal(t, []string{"plugin", "--flag"}, args.Rest)
+}
+
+func TestEnvPrefixInSubcommands(t *testing.T) {
+	type addCmd struct {
+		DryRun bool
+	}
+	type remoteCmd struct {
+		DryRun bool
+		Add    *addCmd `arg:"subcommand:add"`
+	}
+	var args struct {
+		DryRun bool
+		Remote *remoteCmd `arg:"subcommand"`
+	}
+	setenv(t, "GIT_REMOTE_DRY_RUN", "true")
+	setenv(t, "GIT_REMOTE_ADD_DRY_RUN", "true")
+	defer os.Unsetenv("GIT_REMOTE_DRY_RUN")
+	defer os.Unsetenv("GIT_REMOTE_ADD_DRY_RUN")
+
+	_, err := pparseconfig(Config{EnvPrefix: "GIT"}, "remote add", &args)
+	require.NoError(t, err)
+	assert.False(t, args.DryRun)
+	require.NotNil(t, args.Remote)
+	assert.True(t, args.Remote.DryRun)
+	require.NotNil(t, args.Remote.Add)
+	assert.True(t, args.Remote.Add.DryRun)
+}
+
+func TestEnvPrefixWithCustomSubcommandParser(t *testing.T) {
+	type cmd struct {
+		List *subCmdA `arg:"subcommand"`
+	}
+	setenv(t, "PRE_LIST_FOO", "from-env")
+	defer os.Unsetenv("PRE_LIST_FOO")
+
+	var args cmd
+	_, err := pparseconfig(Config{EnvPrefix: "PRE"}, "list --type a", &args)
+	require.NoError(t, err)
+	opts, ok := args.List.Options.(*optsA)
+	require.True(t, ok)
+	assert.Equal(t, "from-env", opts.Foo)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -22,9 +23,35 @@ func (p *Parser) Fail(msg string) {
 
 // failWithCommand prints usage information for the given subcommand to stderr and exits with non-zero status
 func (p *Parser) failWithCommand(msg string, cmd *command) {
-	p.writeUsageForCommand(stderr, cmd)
-	fmt.Fprintln(stderr, "error:", msg)
-	osExit(-1)
+	w := p.stderr()
+	p.writeUsageForCommand(w, cmd)
+	fmt.Fprintln(w, "error:", msg)
+	p.exit(-1)
+}
+
+// stdout returns the writer for help and version text
+func (p *Parser) stdout() io.Writer {
+	if p.config.Stdout != nil {
+		return p.config.Stdout
+	}
+	return os.Stdout
+}
+
+// stderr returns the writer for usage and error messages
+func (p *Parser) stderr() io.Writer {
+	if p.config.Stderr != nil {
+		return p.config.Stderr
+	}
+	return stderr
+}
+
+// exit ends the program with the given status
+func (p *Parser) exit(code int) {
+	if p.config.Exit != nil {
+		p.config.Exit(code)
+		return
+	}
+	osExit(code)
 }
 
 // WriteUsage writes usage information to the given writer
@@ -63,12 +90,20 @@ func (p *Parser) writeUsageForCommand(w io.Writer, cmd *command) {
 
 	// write the option component of the usage message
 	for _, spec := range options {
+		// the options in a group are written together in place of the first one
+		if spec.group != nil {
+			if spec == spec.group.members[0] {
+				fmt.Fprint(w, " "+spec.group.synopsis())
+			}
+			continue
+		}
+
 		// prefix with a space
 		fmt.Fprint(w, " ")
 		if !spec.required {
 			fmt.Fprint(w, "[")
 		}
-		fmt.Fprint(w, synopsis(spec, "--"+spec.long))
+		fmt.Fprint(w, synopsis(spec, usageForm(spec)))
 		if !spec.required {
 			fmt.Fprint(w, "]")
 		}
@@ -91,10 +126,16 @@ func (p *Parser) writeUsageForCommand(w io.Writer, cmd *command) {
 			fmt.Fprint(w, up)
 		}
 	}
+
+	// write the passthrough component of the usage message
+	if cmd.passthrough != nil {
+		up := strings.ToUpper(cmd.passthrough.long)
+		fmt.Fprintf(w, " [%s ...]", up)
+	}
 	fmt.Fprint(w, "\n")
 }
 
-func printTwoCols(w io.Writer, left, help string, defaultVal *string) {
+func printTwoCols(w io.Writer, left, help string, defaultVal *string, envVar string) {
 	lhs := "  " + left
 	fmt.Fprint(w, lhs)
 	if help != "" {
@@ -108,6 +149,9 @@ func printTwoCols(w io.Writer, left, help string, defaultVal *string) {
 	if defaultVal != nil {
 		fmt.Fprintf(w, " [default: %s]", *defaultVal)
 	}
+	if envVar != "" {
+		fmt.Fprintf(w, " [env: %s]", envVar)
+	}
 	fmt.Fprint(w, "\n")
 }
 
@@ -133,10 +177,13 @@ func (p *Parser) writeHelpForCommand(w io.Writer, cmd *command) {
 	p.writeUsageForCommand(w, cmd)
 
 	// write the list of positionals
+	if cmd.passthrough != nil {
+		positionals = append(positionals, cmd.passthrough)
+	}
 	if len(positionals) > 0 {
 		fmt.Fprint(w, "\nPositional arguments:\n")
 		for _, spec := range positionals {
-			printTwoCols(w, strings.ToUpper(spec.long), spec.help, nil)
+			printTwoCols(w, strings.ToUpper(spec.long), spec.help, nil, spec.env)
 		}
 	}
 
@@ -165,16 +212,23 @@ func (p *Parser) writeHelpForCommand(w io.Writer, cmd *command) {
 	if len(cmd.subcommands) > 0 {
 		fmt.Fprint(w, "\nCommands:\n")
 		for _, subcmd := range cmd.subcommands {
-			printTwoCols(w, subcmd.name, subcmd.help, nil)
+			printTwoCols(w, subcmd.name, subcmd.help, nil, "")
 		}
 	}
 }
 
 func (p *Parser) printOption(w io.Writer, spec *spec) {
-	left := synopsis(spec, "--"+spec.long)
+	left := synopsis(spec, longForm(spec))
 	if spec.short != "" {
 		left += ", " + synopsis(spec, "-"+spec.short)
 	}
+	envVar := spec.env
+	if spec.secret && !spec.positional {
+		left += ", --" + spec.long + secretFileSuffix + " FILE"
+		if envVar != "" {
+			envVar += ", " + envVar + "_FILE"
+		}
+	}
 
 	// If spec.dest is not the zero value then a default value has been added.
 	var v reflect.Value
@@ -183,7 +237,13 @@ func (p *Parser) printOption(w io.Writer, spec *spec) {
 	}
 
 	var defaultVal *string
-	if v.IsValid() {
+	if spec.defaultVal != "" {
+		defaultVal = ptrTo(spec.defaultVal)
+	} else if v.IsValid() && v.Kind() == reflect.Map {
+		if v.Len() > 0 {
+			defaultVal = ptrTo(formatMap(v))
+		}
+	} else if v.IsValid() {
 		z := reflect.Zero(v.Type())
 		if (v.Type().Comparable() && z.Type().Comparable() && v.Interface() != z.Interface()) || v.Kind() == reflect.Slice && !v.IsNil() {
 			if scalar, ok := v.Interface().(encoding.TextMarshaler); ok {
@@ -197,14 +257,105 @@ func (p *Parser) printOption(w io.Writer, spec *spec) {
 			}
 		}
 	}
-	printTwoCols(w, left, spec.help, defaultVal)
+	if defaultVal != nil && spec.secret {
+		defaultVal = ptrTo(secretMask)
+	}
+	help := spec.help
+	if bounds := formatBounds(spec); bounds != "" {
+		if help != "" {
+			help += " "
+		}
+		help += bounds
+	}
+	printTwoCols(w, left, help, defaultVal, envVar)
+}
+
+// formatBounds describes the bounds given by the min and max tags, if any
+func formatBounds(spec *spec) string {
+	switch {
+	case spec.min.IsValid() && spec.max.IsValid():
+		return fmt.Sprintf("[range: %s..%s]", formatNumber(spec.min), formatNumber(spec.max))
+	case spec.min.IsValid():
+		return fmt.Sprintf("[min: %s]", formatNumber(spec.min))
+	case spec.max.IsValid():
+		return fmt.Sprintf("[max: %s]", formatNumber(spec.max))
+	}
+	return ""
+}
+
+// longForm returns the long form of an option, including the negated form for
+// options that accept one
+func longForm(spec *spec) string {
+	if spec.negatable {
+		return "--[no-]" + spec.long
+	}
+	return "--" + spec.long
+}
+
+// usageForm returns the form of an option shown in the usage line, which for
+// a counter is the repeatable short form, such as "-v..."
+func usageForm(spec *spec) string {
+	if !spec.counter {
+		return longForm(spec)
+	}
+	if spec.short != "" {
+		return "-" + spec.short + "..."
+	}
+	return longForm(spec) + "..."
 }
 
 func synopsis(spec *spec, form string) string {
-	if spec.boolean {
+	if spec.boolean || spec.counter {
 		return form
 	}
-	return form + " " + strings.ToUpper(spec.long)
+	if spec.optional {
+		return form + "[=" + placeholder(spec) + "]"
+	}
+	if spec.nargs > 0 {
+		return form + strings.Repeat(" "+placeholder(spec), spec.nargs)
+	}
+	return form + " " + placeholder(spec)
+}
+
+// placeholder returns the text that stands for the value of an option, which
+// lists the allowed values if they are limited
+func placeholder(spec *spec) string {
+	if len(spec.choices) > 0 {
+		return "{" + strings.Join(spec.choices, ",") + "}"
+	}
+	return strings.ToUpper(spec.long)
+}
+
+// formatMap formats a map as key=value pairs sorted by key
+func formatMap(v reflect.Value) string {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return lessValue(keys[i], keys[j])
+	})
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		val := v.MapIndex(key)
+		if val.Kind() == reflect.Ptr && !val.IsNil() {
+			val = val.Elem()
+		}
+		pairs[i] = fmt.Sprintf("%v=%v", key, val)
+	}
+	return "[" + strings.Join(pairs, " ") + "]"
+}
+
+// lessValue orders numbers numerically and everything else by its string form
+func lessValue(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	default:
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	}
 }
 
 func ptrTo(s string) *string {
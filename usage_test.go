@@ -33,9 +33,9 @@ func (n *NameDotName) MarshalText() (text []byte, err error) {
 }
 
 func TestWriteUsage(t *testing.T) {
-	expectedUsage := "Usage: example [--name NAME] [--value VALUE] [--verbose] [--dataset DATASET] [--optimize OPTIMIZE] [--ids IDS] [--values VALUES] [--workers WORKERS] [--file FILE] INPUT [OUTPUT [OUTPUT ...]]\n"
+	expectedUsage := "Usage: example [--name NAME] [--value VALUE] [--[no-]verbose] [--dataset DATASET] [--optimize OPTIMIZE] [--ids IDS] [--values VALUES] [--workers WORKERS] [--file FILE] INPUT [OUTPUT [OUTPUT ...]]\n"
 
-	expectedHelp := `Usage: example [--name NAME] [--value VALUE] [--verbose] [--dataset DATASET] [--optimize OPTIMIZE] [--ids IDS] [--values VALUES] [--workers WORKERS] [--file FILE] INPUT [OUTPUT [OUTPUT ...]]
+	expectedHelp := `Usage: example [--name NAME] [--value VALUE] [--[no-]verbose] [--dataset DATASET] [--optimize OPTIMIZE] [--ids IDS] [--values VALUES] [--workers WORKERS] [--file FILE] INPUT [OUTPUT [OUTPUT ...]]
 
 Positional arguments:
   INPUT
@@ -44,14 +44,14 @@ Positional arguments:
 Options:
   --name NAME            name to use [default: Foo Bar]
   --value VALUE          secret value [default: 42]
-  --verbose, -v          verbosity level
+  --[no-]verbose, -v     verbosity level
   --dataset DATASET      dataset to use
   --optimize OPTIMIZE, -O OPTIMIZE
                          optimization level
   --ids IDS              Ids
   --values VALUES        Values [default: [3.14 42 256]]
   --workers WORKERS, -w WORKERS
-                         number of workers to start
+                         number of workers to start [env: WORKERS]
   --file FILE, -f FILE   File with mandatory extension [default: scratch.txt]
   --help, -h             display this help and exit
 `
@@ -72,7 +72,7 @@ Options:
 	args.Value = 42
 	args.Values = []float64{3.14, 42, 256}
 	args.File = &NameDotName{"scratch", "txt"}
-	p, err := NewParser(Config{"example"}, &args)
+	p, err := NewParser(Config{Program: "example"}, &args)
 	require.NoError(t, err)
 
 	os.Args[0] = "example"
@@ -108,7 +108,7 @@ Options:
 	}
 	v := MyEnum(42)
 	args.Name = &v
-	p, err := NewParser(Config{"example"}, &args)
+	p, err := NewParser(Config{Program: "example"}, &args)
 
 	// NB: some might might expect there to be an error here
 	require.NoError(t, err)
@@ -260,3 +260,269 @@ Options:
 	p.WriteHelp(&help)
 	assert.Equal(t, expectedHelp, help.String())
 }
+
+func TestUsageNegatable(t *testing.T) {
+	expectedHelp := `Usage: example [--[no-]cache] [--force]
+
+Options:
+  --[no-]cache, -c       use the cache [default: true]
+  --force                overwrite existing files
+  --help, -h             display this help and exit
+`
+	var args struct {
+		Cache bool `arg:"-c" help:"use the cache"`
+		Force bool `arg:"nonegate" help:"overwrite existing files"`
+	}
+	args.Cache = true
+	p, err := NewParser(Config{Program: "example"}, &args)
+	require.NoError(t, err)
+
+	var help bytes.Buffer
+	p.WriteHelp(&help)
+	assert.Equal(t, expectedHelp, help.String())
+}
+
+func TestUsageCounter(t *testing.T) {
+	expectedHelp := `Usage: example [-v...] [--debug...]
+
+Options:
+  --verbose, -v          increase verbosity
+  --debug                increase debug output
+  --help, -h             display this help and exit
+`
+	var args struct {
+		Verbose int `arg:"-v,counter" help:"increase verbosity"`
+		Debug   int `arg:"counter" help:"increase debug output"`
+	}
+	p, err := NewParser(Config{Program: "example"}, &args)
+	require.NoError(t, err)
+
+	var help bytes.Buffer
+	p.WriteHelp(&help)
+	assert.Equal(t, expectedHelp, help.String())
+}
+
+func TestUsageOptionalValue(t *testing.T) {
+	expectedHelp := `Usage: example [--color[=COLOR]]
+
+Options:
+  --color[=COLOR], -c[=COLOR]
+                         when to use colors
+  --help, -h             display this help and exit
+`
+	var args struct {
+		Color string `arg:"-c,optional:auto" help:"when to use colors"`
+	}
+	p, err := NewParser(Config{Program: "example"}, &args)
+	require.NoError(t, err)
+
+	var help bytes.Buffer
+	p.WriteHelp(&help)
+	assert.Equal(t, expectedHelp, help.String())
+}
+
+func TestUsageNargs(t *testing.T) {
+	expectedHelp := `Usage: example [--point POINT POINT]
+
+Options:
+  --point POINT POINT    a point on the plane
+  --help, -h             display this help and exit
+`
+	var args struct {
+		Point []int `arg:"nargs:2" help:"a point on the plane"`
+	}
+	p, err := NewParser(Config{Program: "example"}, &args)
+	require.NoError(t, err)
+
+	var help bytes.Buffer
+	p.WriteHelp(&help)
+	assert.Equal(t, expectedHelp, help.String())
+}
+
+func TestUsageMapDefault(t *testing.T) {
+	expectedHelp := `Usage: example [--label LABEL] [--weight WEIGHT]
+
+Options:
+  --label LABEL          labels to apply [default: [env=prod tier=web zone=a]]
+  --weight WEIGHT [default: [2=0.5 10=1]]
+  --help, -h             display this help and exit
+`
+	var args struct {
+		Label  map[string]string `help:"labels to apply"`
+		Weight map[int]float64
+	}
+	args.Label = map[string]string{"zone": "a", "env": "prod", "tier": "web"}
+	args.Weight = map[int]float64{10: 1, 2: 0.5}
+	p, err := NewParser(Config{Program: "example"}, &args)
+	require.NoError(t, err)
+
+	var help bytes.Buffer
+	p.WriteHelp(&help)
+	assert.Equal(t, expectedHelp, help.String())
+}
+
+func TestUsageVariadicPositionalBeforeSingle(t *testing.T) {
+	expectedUsage := "Usage: cp SOURCES [SOURCES ...] DEST\n"
+	var args struct {
+		Sources []string `arg:"positional,required"`
+		Dest    string   `arg:"positional,required"`
+	}
+	p, err := NewParser(Config{Program: "cp"}, &args)
+	require.NoError(t, err)
+
+	var usage bytes.Buffer
+	p.WriteUsage(&usage)
+	assert.Equal(t, expectedUsage, usage.String())
+}
+
+func TestUsagePassthrough(t *testing.T) {
+	expectedHelp := `Usage: example [--[no-]verbose] HOST [SSHARGS ...]
+
+Positional arguments:
+  HOST
+  SSHARGS                arguments passed on to ssh
+
+Options:
+  --[no-]verbose
+  --help, -h             display this help and exit
+`
+	var args struct {
+		Host    string `arg:"positional"`
+		Verbose bool
+		SSHArgs []string `arg:"passthrough" help:"arguments passed on to ssh"`
+	}
+	p, err := NewParser(Config{Program: "example"}, &args)
+	require.NoError(t, err)
+
+	var help bytes.Buffer
+	p.WriteHelp(&help)
+	assert.Equal(t, expectedHelp, help.String())
+}
+
+func TestUsageEnvPrefix(t *testing.T) {
+	expectedHelp := `Usage: example [--maxretries MAXRETRIES] [--local LOCAL]
+
+Options:
+  --maxretries MAXRETRIES
+                         number of retries [default: 3] [env: APP_MAX_RETRIES]
+  --local LOCAL          not bound to the environment
+  --help, -h             display this help and exit
+`
+	var args struct {
+		MaxRetries int    `help:"number of retries"`
+		Local      string `arg:"noenv" help:"not bound to the environment"`
+	}
+	args.MaxRetries = 3
+	p, err := NewParser(Config{Program: "example", EnvPrefix: "APP"}, &args)
+	require.NoError(t, err)
+
+	var help bytes.Buffer
+	p.WriteHelp(&help)
+	assert.Equal(t, expectedHelp, help.String())
+}
+
+func TestUsageDefaultTag(t *testing.T) {
+	expectedHelp := `Usage: example get [--retries RETRIES] [--names NAMES]
+
+Options:
+  --retries RETRIES      number of retries [default: 4]
+  --names NAMES          users to fetch [default: alice,bob]
+  --help, -h             display this help and exit
+`
+	type getCmd struct {
+		Retries int      `default:"4" help:"number of retries"`
+		Names   []string `default:"alice,bob" help:"users to fetch"`
+	}
+	var args struct {
+		Get *getCmd `arg:"subcommand"`
+	}
+	p, err := NewParser(Config{Program: "example"}, &args)
+	require.NoError(t, err)
+
+	var help bytes.Buffer
+	p.writeHelpForCommand(&help, p.cmd.subcommands[0])
+	assert.Equal(t, expectedHelp, help.String())
+}
+
+func TestUsageSecret(t *testing.T) {
+	expectedHelp := `Usage: example [--password PASSWORD]
+
+Options:
+  --password PASSWORD, --password-file FILE
+                         database password [default: ******] [env: DB_PASSWORD, DB_PASSWORD_FILE]
+  --help, -h             display this help and exit
+`
+	var args struct {
+		Password string `arg:"env:DB_PASSWORD,secret" help:"database password"`
+	}
+	args.Password = "hunter2"
+	p, err := NewParser(Config{Program: "example"}, &args)
+	require.NoError(t, err)
+
+	var help bytes.Buffer
+	p.WriteHelp(&help)
+	assert.Equal(t, expectedHelp, help.String())
+}
+
+func TestUsageChoices(t *testing.T) {
+	expectedHelp := `Usage: example [--format {json,yaml,table}] [--color[={auto,always,never}]]
+
+Options:
+  --format {json,yaml,table}
+                         output format [default: table]
+  --color[={auto,always,never}]
+                         when to use color
+  --help, -h             display this help and exit
+`
+	var args struct {
+		Format string `default:"table" choices:"json,yaml,table" help:"output format"`
+		Color  string `arg:"optional:auto" choices:"auto,always,never" help:"when to use color"`
+	}
+	p, err := NewParser(Config{Program: "example"}, &args)
+	require.NoError(t, err)
+
+	var help bytes.Buffer
+	p.WriteHelp(&help)
+	assert.Equal(t, expectedHelp, help.String())
+}
+
+func TestUsageGroups(t *testing.T) {
+	expectedUsage := "Usage: example (--file FILE | --url URL) [--user USER --password PASSWORD] [--quiet | --verbose] [--dry]\n"
+	var args struct {
+		File     string `oneof:"source"`
+		User     string `together:"auth"`
+		URL      string `oneof:"source"`
+		Password string `together:"auth"`
+		Quiet    bool   `arg:"nonegate" xor:"noise"`
+		Verbose  bool   `arg:"nonegate" xor:"noise"`
+		Dry      bool   `arg:"nonegate"`
+	}
+	p, err := NewParser(Config{Program: "example"}, &args)
+	require.NoError(t, err)
+
+	var usage bytes.Buffer
+	p.WriteUsage(&usage)
+	assert.Equal(t, expectedUsage, usage.String())
+}
+
+func TestUsageMinMax(t *testing.T) {
+	expectedHelp := `Usage: example [--workers WORKERS] [--port PORT] [--ratio RATIO]
+
+Options:
+  --workers WORKERS      number of workers [range: 1..64] [default: 4]
+  --port PORT            [min: 1024]
+  --ratio RATIO          fraction to keep [max: 1]
+  --help, -h             display this help and exit
+`
+	var args struct {
+		Workers int     `min:"1" max:"64" default:"4" help:"number of workers"`
+		Port    int     `min:"1024"`
+		Ratio   float64 `max:"1" help:"fraction to keep"`
+	}
+	p, err := NewParser(Config{Program: "example"}, &args)
+	require.NoError(t, err)
+
+	var help bytes.Buffer
+	p.WriteHelp(&help)
+	assert.Equal(t, expectedHelp, help.String())
+}